@@ -38,6 +38,14 @@
 #define KCOV_ENABLE _IO('c', 100)
 #define KCOV_DISABLE _IO('c', 101)
 
+#define KCOV_TRACE_PC 0
+#define KCOV_TRACE_CMP 1
+
+// Comparison type bits as set by the kernel in kcov_comparison_t::type.
+#define KCOV_CMP_CONST (1 << 0)
+#define KCOV_CMP_SIZE(n) ((n) << 1)
+#define KCOV_CMP_MASK KCOV_CMP_SIZE(3)
+
 const int kInFd = 3;
 const int kOutFd = 4;
 const int kInPipeFd = 5;
@@ -53,6 +61,7 @@ const int kPageSize = 4 << 10;
 const uint64_t instr_eof = -1;
 const uint64_t instr_copyin = -2;
 const uint64_t instr_copyout = -3;
+const uint64_t instr_async = -4;
 
 const uint64_t arg_const = 0;
 const uint64_t arg_result = 1;
@@ -80,11 +89,18 @@ bool flag_enable_fault_injection;
 
 bool flag_collect_cover;
 bool flag_dedup_cover;
+// If true, then executor should write the comparisons data to fuzzer.
+bool flag_collect_comps;
 // Inject fault into flag_fault_nth-th operation in flag_fault_call-th syscall.
 bool flag_inject_fault;
 int flag_fault_call;
 int flag_fault_nth;
 
+// Sorted non-overlapping [start, end) PC ranges, only these PCs produce feedback signal.
+// Passed by fuzzer with -cover_filter=file argument (see ipc.WriteCoverFilter).
+uint32_t* cover_filter;
+uint32_t cover_filter_size;
+
 __attribute__((aligned(64 << 10))) char input_data[kMaxInput];
 uint32_t* output_data;
 uint32_t* output_pos;
@@ -122,6 +138,19 @@ struct thread_t {
 
 thread_t threads[kMaxThreads];
 
+// Layout of a single comparison record in the kcov buffer in KCOV_TRACE_CMP mode.
+struct kcov_comparison_t {
+	uint64_t type;
+	uint64_t arg1;
+	uint64_t arg2;
+	uint64_t pc;
+
+	bool ignore() const;
+	void write();
+	bool operator==(const struct kcov_comparison_t& other) const;
+	bool operator<(const struct kcov_comparison_t& other) const;
+};
+
 // Checksum kinds.
 const uint64_t arg_csum_inet = 0;
 
@@ -145,6 +174,8 @@ void cover_open();
 void cover_enable(thread_t* th);
 void cover_reset(thread_t* th);
 uint64_t cover_read(thread_t* th);
+void cover_filter_load(const char* file);
+static bool cover_filter_contains(uint32_t pc);
 static uint32_t hash(uint32_t a);
 static bool dedup(uint32_t sig);
 
@@ -185,6 +216,11 @@ int main(int argc, char** argv)
 
 	uint64_t executor_pid = *((uint64_t*)input_data + 1);
 	cover_open();
+	const char* filter_arg = "-cover_filter=";
+	for (int i = 1; i < argc; i++) {
+		if (strncmp(argv[i], filter_arg, strlen(filter_arg)) == 0)
+			cover_filter_load(argv[i] + strlen(filter_arg));
+	}
 	install_segv_handler();
 	use_temporary_dir();
 
@@ -254,10 +290,11 @@ void loop()
 		flag_collect_cover = in_cmd[0] & (1 << 0);
 		flag_dedup_cover = in_cmd[0] & (1 << 1);
 		flag_inject_fault = in_cmd[0] & (1 << 2);
+		flag_collect_comps = in_cmd[0] & (1 << 3);
 		flag_fault_call = in_cmd[1];
 		flag_fault_nth = in_cmd[2];
-		debug("exec opts: cover=%d dedup=%d fault=%d/%d/%d\n", flag_collect_cover, flag_dedup_cover,
-		      flag_inject_fault, flag_fault_call, flag_fault_nth);
+		debug("exec opts: cover=%d comps=%d dedup=%d fault=%d/%d/%d\n", flag_collect_cover, flag_collect_comps,
+		      flag_dedup_cover, flag_inject_fault, flag_fault_call, flag_fault_nth);
 
 		int pid = fork();
 		if (pid < 0)
@@ -351,10 +388,16 @@ retry:
 		cover_enable(&threads[0]);
 
 	int call_index = 0;
+	// Set by instr_async, the next call is not waited for.
+	bool async = false;
 	for (int n = 0;; n++) {
 		uint64_t call_num = read_input(&input_pos);
 		if (call_num == instr_eof)
 			break;
+		if (call_num == instr_async) {
+			async = true;
+			continue;
+		}
 		if (call_num == instr_copyin) {
 			char* addr = (char*)read_input(&input_pos);
 			uint64_t typ = read_input(&input_pos);
@@ -454,6 +497,9 @@ retry:
 		if (collide && (call_index % 2) == 0) {
 			// Don't wait for every other call.
 			// We already have results from the previous execution.
+		} else if (flag_threaded && async) {
+			// Don't wait for async calls, the next call runs concurrently.
+			// Async calls are waited for at the end of the program.
 		} else if (flag_threaded) {
 			// Wait for call completion.
 			uint64_t start = current_time_ms();
@@ -493,6 +539,21 @@ retry:
 			execute_call(th);
 			handle_completion(th);
 		}
+		async = false;
+	}
+
+	if (flag_threaded && !collide && running > 0) {
+		// Give async calls that are still running some time to complete.
+		uint64_t start = current_time_ms();
+		const uint64_t timeout_ms = flag_debug ? 500 : 20;
+		while (running > 0 && current_time_ms() - start < timeout_ms) {
+			usleep(100);
+			for (int i = 0; i < kMaxThreads; i++) {
+				thread_t* th = &threads[i];
+				if (__atomic_load_n(&th->done, __ATOMIC_ACQUIRE) && !th->handled)
+					handle_completion(th);
+			}
+		}
 	}
 
 	if (flag_collide && !flag_inject_fault && !collide) {
@@ -577,15 +638,37 @@ void handle_completion(thread_t* th)
 		write_output(th->fault_injected);
 		uint32_t* signal_count_pos = write_output(0); // filled in later
 		uint32_t* cover_count_pos = write_output(0); // filled in later
+		uint32_t* comps_count_pos = write_output(0); // filled in later
 
-		// Write out feedback signals.
-		// Currently it is code edges computed as xor of two subsequent basic block PCs.
 		uint64_t* cover_data = th->cover_data + 1;
 		uint32_t cover_size = th->cover_size;
 		uint32_t prev = 0;
 		uint32_t nsig = 0;
+		if (flag_collect_comps) {
+			// Collect only the comparisons.
+			// In this mode cover_data holds cover_size records of 4 words each
+			// and there is no meaningful signal or coverage.
+			kcov_comparison_t* start = (kcov_comparison_t*)cover_data;
+			kcov_comparison_t* end = start + cover_size;
+			std::sort(start, end);
+			uint32_t ncomps = std::unique(start, end) - start;
+			uint32_t written = 0;
+			for (uint32_t i = 0; i < ncomps; i++) {
+				if (start[i].ignore())
+					continue;
+				start[i].write();
+				written++;
+			}
+			*comps_count_pos = written;
+			cover_size = 0;
+		}
+		// Write out feedback signals.
+		// Currently it is code edges computed as xor of two subsequent basic block PCs.
+		// PCs outside of cover filter are skipped.
 		for (uint32_t i = 0; i < cover_size; i++) {
 			uint32_t pc = cover_data[i];
+			if (!cover_filter_contains(pc))
+				continue;
 			uint32_t sig = pc ^ prev;
 			prev = hash(pc);
 			if (dedup(sig))
@@ -614,8 +697,8 @@ void handle_completion(thread_t* th)
 				write_output((uint32_t)cover_data[i]);
 			*cover_count_pos = cover_size;
 		}
-		debug("out #%u: index=%u num=%u errno=%d sig=%u cover=%u\n",
-		      completed, th->call_index, th->call_num, reserrno, nsig, cover_size);
+		debug("out #%u: index=%u num=%u errno=%d sig=%u cover=%u comps=%u\n",
+		      completed, th->call_index, th->call_num, reserrno, nsig, cover_size, *comps_count_pos);
 
 		completed++;
 		__atomic_store_n(output_data, completed, __ATOMIC_RELEASE);
@@ -722,7 +805,8 @@ void cover_enable(thread_t* th)
 	if (!flag_cover)
 		return;
 	debug("#%d: enabling /sys/kernel/debug/kcov\n", th->id);
-	if (ioctl(th->cover_fd, KCOV_ENABLE, 0)) {
+	int kcov_mode = flag_collect_comps ? KCOV_TRACE_CMP : KCOV_TRACE_PC;
+	if (ioctl(th->cover_fd, KCOV_ENABLE, kcov_mode)) {
 		// This should be fatal,
 		// but in practice ioctl fails with assorted errors (9, 14, 25),
 		// so we use exitf.
@@ -744,11 +828,103 @@ uint64_t cover_read(thread_t* th)
 		return 0;
 	uint64_t n = __atomic_load_n(&th->cover_data[0], __ATOMIC_RELAXED);
 	debug("#%d: read cover = %d\n", th->id, n);
-	if (n >= kCoverSize)
+	// In comparison mode every record occupies 4 words.
+	uint64_t words = flag_collect_comps ? n * 4 : n;
+	if (words >= kCoverSize)
 		fail("#%d: too much cover %d", th->id, n);
 	return n;
 }
 
+void cover_filter_load(const char* file)
+{
+	int fd = open(file, O_RDONLY);
+	if (fd == -1)
+		fail("failed to open cover filter %s", file);
+	struct stat st;
+	if (fstat(fd, &st))
+		fail("failed to stat cover filter");
+	cover_filter_size = st.st_size / (2 * sizeof(uint32_t));
+	ssize_t size = cover_filter_size * 2 * sizeof(uint32_t);
+	if (size == 0)
+		fail("empty cover filter");
+	cover_filter = (uint32_t*)malloc(size);
+	if (cover_filter == NULL)
+		fail("failed to allocate cover filter");
+	if (read(fd, cover_filter, size) != size)
+		fail("failed to read cover filter");
+	close(fd);
+	debug("loaded cover filter with %u ranges\n", cover_filter_size);
+}
+
+static bool cover_filter_contains(uint32_t pc)
+{
+	if (cover_filter == NULL)
+		return true;
+	uint32_t lo = 0, hi = cover_filter_size;
+	while (lo < hi) {
+		uint32_t mid = lo + (hi - lo) / 2;
+		if (pc < cover_filter[mid * 2])
+			hi = mid;
+		else if (pc >= cover_filter[mid * 2 + 1])
+			lo = mid + 1;
+		else
+			return true;
+	}
+	return false;
+}
+
+void kcov_comparison_t::write()
+{
+	// Write order: type arg1 arg2.
+	write_output((uint32_t)type);
+	// KCOV converts all arguments of size x first to uintx_t and then to
+	// uint64_t. We want to properly extend signed values, e.g we want
+	// int8_t c = 0xfe to be represented as 0xfffffffffffffffe.
+	// Note that uint8_t c = 0xfe will be represented the same way.
+	// This is ok because during hints processing we will anyways try
+	// the value 0x00000000000000fe.
+	switch (type & KCOV_CMP_MASK) {
+	case KCOV_CMP_SIZE(0):
+		arg1 = (uint64_t)(int64_t)(int8_t)arg1;
+		arg2 = (uint64_t)(int64_t)(int8_t)arg2;
+		break;
+	case KCOV_CMP_SIZE(1):
+		arg1 = (uint64_t)(int64_t)(int16_t)arg1;
+		arg2 = (uint64_t)(int64_t)(int16_t)arg2;
+		break;
+	case KCOV_CMP_SIZE(2):
+		arg1 = (uint64_t)(int64_t)(int32_t)arg1;
+		arg2 = (uint64_t)(int64_t)(int32_t)arg2;
+		break;
+	}
+	write_output((uint32_t)(arg1 & 0xFFFFFFFF));
+	write_output((uint32_t)(arg1 >> 32));
+	write_output((uint32_t)(arg2 & 0xFFFFFFFF));
+	write_output((uint32_t)(arg2 >> 32));
+}
+
+bool kcov_comparison_t::ignore() const
+{
+	// Comparisons of equal operands don't give any information.
+	return arg1 == arg2;
+}
+
+bool kcov_comparison_t::operator==(const struct kcov_comparison_t& other) const
+{
+	// We don't check for PC equality now, because it is not used.
+	return type == other.type && arg1 == other.arg1 && arg2 == other.arg2;
+}
+
+bool kcov_comparison_t::operator<(const struct kcov_comparison_t& other) const
+{
+	if (type != other.type)
+		return type < other.type;
+	if (arg1 != other.arg1)
+		return arg1 < other.arg1;
+	// We don't check for PC equality now, because it is not used.
+	return arg2 < other.arg2;
+}
+
 static uint32_t hash(uint32_t a)
 {
 	a = (a ^ 61) ^ (a >> 16);
@@ -180,3 +180,30 @@ func SignalAdd(base map[uint32]struct{}, signal []uint32) {
 		base[s] = struct{}{}
 	}
 }
+
+// MergeRanges returns sorted [start, end) PC ranges with overlapping and adjacent ranges merged.
+func MergeRanges(ranges [][2]uint32) [][2]uint32 {
+	if len(ranges) == 0 {
+		return nil
+	}
+	sorted := append([][2]uint32{}, ranges...)
+	sort.Sort(rangeArray(sorted))
+	merged := sorted[:1]
+	for _, r := range sorted[1:] {
+		last := &merged[len(merged)-1]
+		if r[0] <= last[1] {
+			if r[1] > last[1] {
+				last[1] = r[1]
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+type rangeArray [][2]uint32
+
+func (a rangeArray) Len() int           { return len(a) }
+func (a rangeArray) Less(i, j int) bool { return a[i][0] < a[j][0] }
+func (a rangeArray) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
@@ -233,3 +233,14 @@ func BenchmarkHasDifference(b *testing.B) {
 		_ = HasDifference(cov1, cov0)
 	}
 }
+
+func TestMergeRanges(t *testing.T) {
+	ranges := [][2]uint32{{0x300, 0x400}, {0x100, 0x200}, {0x150, 0x250}, {0x250, 0x260}, {0x320, 0x330}}
+	want := [][2]uint32{{0x100, 0x260}, {0x300, 0x400}}
+	if got := MergeRanges(ranges); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %x, want %x", got, want)
+	}
+	if ranges[0] != [2]uint32{0x300, 0x400} {
+		t.Fatalf("input ranges are modified: %x", ranges)
+	}
+}
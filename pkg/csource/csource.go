@@ -69,6 +69,14 @@ func Write(p *prog.Prog, opts Options) ([]byte, error) {
 	}
 	fmt.Fprintf(w, "\n")
 
+	for _, c := range p.Calls {
+		if c.Async {
+			// Async calls can only run in threaded mode.
+			opts.Threaded = true
+			break
+		}
+	}
+
 	hdr, err := preprocessCommonHeader(opts, handled, prog.RequiresBitmasks(p), prog.RequiresChecksums(p))
 	if err != nil {
 		return nil, err
@@ -76,11 +84,11 @@ func Write(p *prog.Prog, opts Options) ([]byte, error) {
 	fmt.Fprint(w, hdr)
 	fmt.Fprint(w, "\n")
 
-	calls, nvar := generateCalls(exec, opts)
+	calls, async, nvar := generateCalls(exec, opts)
 	fmt.Fprintf(w, "long r[%v];\n", nvar)
 
 	if !opts.Repeat {
-		generateTestFunc(w, opts, calls, "loop")
+		generateTestFunc(w, opts, calls, async, "loop")
 
 		fmt.Fprint(w, "int main()\n{\n")
 		if opts.HandleSegv {
@@ -101,7 +109,7 @@ func Write(p *prog.Prog, opts Options) ([]byte, error) {
 		}
 		fmt.Fprint(w, "\treturn 0;\n}\n")
 	} else {
-		generateTestFunc(w, opts, calls, "test")
+		generateTestFunc(w, opts, calls, async, "test")
 		if opts.Procs <= 1 {
 			fmt.Fprint(w, "int main()\n{\n")
 			if opts.HandleSegv {
@@ -176,7 +184,7 @@ func Write(p *prog.Prog, opts Options) ([]byte, error) {
 	return out1, nil
 }
 
-func generateTestFunc(w io.Writer, opts Options, calls []string, name string) {
+func generateTestFunc(w io.Writer, opts Options, calls []string, async []bool, name string) {
 	if !opts.Threaded && !opts.Collide {
 		fmt.Fprintf(w, "void %v()\n{\n", name)
 		if opts.Debug {
@@ -219,7 +227,19 @@ func generateTestFunc(w io.Writer, opts Options, calls []string, name string) {
 		}
 		fmt.Fprintf(w, "\tfor (i = 0; i < %v; i++) {\n", len(calls))
 		fmt.Fprintf(w, "\t\tpthread_create(&th[i], 0, thr, (void*)i);\n")
-		fmt.Fprintf(w, "\t\tusleep(10000);\n")
+		var asyncCalls []string
+		for i, a := range async {
+			if a {
+				asyncCalls = append(asyncCalls, fmt.Sprintf("i != %v", i))
+			}
+		}
+		if len(asyncCalls) != 0 {
+			// Don't give async calls time to complete, the next call runs concurrently.
+			fmt.Fprintf(w, "\t\tif (%v)\n", strings.Join(asyncCalls, " && "))
+			fmt.Fprintf(w, "\t\t\tusleep(10000);\n")
+		} else {
+			fmt.Fprintf(w, "\t\tusleep(10000);\n")
+		}
 		fmt.Fprintf(w, "\t}\n")
 		if opts.Collide {
 			fmt.Fprintf(w, "\tfor (i = 0; i < %v; i++) {\n", len(calls))
@@ -233,7 +253,7 @@ func generateTestFunc(w io.Writer, opts Options, calls []string, name string) {
 	}
 }
 
-func generateCalls(exec []byte, opts Options) ([]string, int) {
+func generateCalls(exec []byte, opts Options) ([]string, []bool, int) {
 	read := func() uintptr {
 		if len(exec) < 8 {
 			panic("exec program overflow")
@@ -255,7 +275,9 @@ func generateCalls(exec []byte, opts Options) ([]string, int) {
 	}
 	lastCall := 0
 	seenCall := false
+	nextAsync := false
 	var calls []string
+	var async []bool
 	w := new(bytes.Buffer)
 	newCall := func() {
 		if seenCall {
@@ -329,6 +351,8 @@ loop:
 			default:
 				panic(fmt.Sprintf("bad argument type %v", instr))
 			}
+		case prog.ExecInstrAsync:
+			nextAsync = true
 		case prog.ExecInstrCopyout:
 			addr := read()
 			size := read()
@@ -388,10 +412,12 @@ loop:
 			}
 			lastCall = n
 			seenCall = true
+			async = append(async, nextAsync)
+			nextAsync = false
 		}
 	}
 	newCall()
-	return calls, n
+	return calls, async, n
 }
 
 func preprocessCommonHeader(opts Options, handled map[string]int, useBitmasks, useChecksums bool) (string, error) {
@@ -18,6 +18,7 @@ import (
 	"time"
 	"unsafe"
 
+	"github.com/google/syzkaller/pkg/cover"
 	"github.com/google/syzkaller/pkg/osutil"
 	"github.com/google/syzkaller/prog"
 )
@@ -54,6 +55,7 @@ const (
 	FlagCollectCover = uint64(1) << iota // collect coverage
 	FlagDedupCover                       // deduplicate coverage in executor
 	FlagInjectFault                      // inject a fault in this execution (see ExecOpts)
+	FlagCollectComps                     // collect KCOV comparisons
 )
 
 const (
@@ -107,6 +109,10 @@ type Config struct {
 
 	// BufferSize is the size of the internal buffer for executor output.
 	BufferSize uint64
+
+	// CoverFilter is a file with PC ranges that restrict feedback signal
+	// (see WriteCoverFilter), signal is not filtered if empty.
+	CoverFilter string
 }
 
 func DefaultConfig() (Config, error) {
@@ -217,12 +223,26 @@ func (env *Env) Close() error {
 	}
 }
 
+const (
+	compConst = 1 << 0 // KCOV_CMP_CONST: the first comparison operand is a compile-time constant
+)
+
 type CallInfo struct {
 	Signal []uint32 // feedback signal, filled if FlagSignal is set
 	Cover  []uint32 // per-call coverage, filled if FlagSignal is set and cover == true,
 	//if dedup == false, then cov effectively contains a trace, otherwise duplicates are removed
 	Errno         int // call errno (0 if the call was successful)
 	FaultInjected bool
+	Comps         prog.CompMap // per-call comparison operands, filled if FlagCollectComps is set
+}
+
+// CallResults converts execution info into results for prog.Annotate.
+func CallResults(info []CallInfo) []prog.CallResult {
+	res := make([]prog.CallResult, len(info))
+	for i, inf := range info {
+		res[i] = prog.CallResult{Errno: inf.Errno, FaultInjected: inf.FaultInjected}
+	}
+	return res
 }
 
 // Exec starts executor binary to execute program p and returns information about the execution:
@@ -302,8 +322,9 @@ func (env *Env) readOutCoverage(p *prog.Prog) (info []CallInfo, err0 error) {
 		return buf.String()
 	}
 	for i := uint32(0); i < ncmd; i++ {
-		var callIndex, callNum, errno, faultInjected, signalSize, coverSize uint32
-		if !readOut(&callIndex) || !readOut(&callNum) || !readOut(&errno) || !readOut(&faultInjected) || !readOut(&signalSize) || !readOut(&coverSize) {
+		var callIndex, callNum, errno, faultInjected, signalSize, coverSize, compsSize uint32
+		if !readOut(&callIndex) || !readOut(&callNum) || !readOut(&errno) || !readOut(&faultInjected) ||
+			!readOut(&signalSize) || !readOut(&coverSize) || !readOut(&compsSize) {
 			err0 = fmt.Errorf("executor %v: failed to read output coverage", env.pid)
 			return
 		}
@@ -339,6 +360,27 @@ func (env *Env) readOutCoverage(p *prog.Prog) (info []CallInfo, err0 error) {
 		}
 		info[callIndex].Cover = out[:coverSize:coverSize]
 		out = out[coverSize:]
+		if compsSize == 0 {
+			continue
+		}
+		comps := make(prog.CompMap)
+		for j := uint32(0); j < compsSize; j++ {
+			var typ, arg1lo, arg1hi, arg2lo, arg2hi uint32
+			if !readOut(&typ) || !readOut(&arg1lo) || !readOut(&arg1hi) || !readOut(&arg2lo) || !readOut(&arg2hi) {
+				err0 = fmt.Errorf("executor %v: failed to read output comparisons: record %v, call %v, comp %v/%v",
+					env.pid, i, callIndex, j, compsSize)
+				return
+			}
+			arg1 := uint64(arg1hi)<<32 | uint64(arg1lo)
+			arg2 := uint64(arg2hi)<<32 | uint64(arg2lo)
+			// For constant comparisons the constant is the first operand,
+			// so only the second one can come from the input.
+			comps.AddComp(arg2, arg1)
+			if typ&compConst == 0 {
+				comps.AddComp(arg1, arg2)
+			}
+		}
+		info[callIndex].Comps = comps
 	}
 	return
 }
@@ -449,7 +491,11 @@ func makeCommand(pid int, bin []string, config Config, inFile *os.File, outFile
 	c.readDone = make(chan []byte, 1)
 	c.exited = make(chan struct{})
 
-	cmd := exec.Command(bin[0], bin[1:]...)
+	args := bin[1:]
+	if config.CoverFilter != "" {
+		args = append(append([]string{}, args...), "-cover_filter="+config.CoverFilter)
+	}
+	cmd := exec.Command(bin[0], args...)
 	cmd.ExtraFiles = []*os.File{inFile, outFile, outrp, inwp}
 	cmd.Env = []string{}
 	cmd.Dir = dir
@@ -660,6 +706,28 @@ func (c *command) exec(opts *ExecOpts) (output []byte, failed, hanged, restart b
 	return
 }
 
+// WriteCoverFilter writes [start, end) PC ranges (truncated to 32 bits as in coverage)
+// to file in the format expected by executor.
+func WriteCoverFilter(filename string, ranges [][2]uint32) error {
+	if len(ranges) == 0 {
+		return fmt.Errorf("empty cover filter")
+	}
+	// Executor uses binary search, so ranges must be sorted and must not overlap.
+	merged := cover.MergeRanges(ranges)
+	buf := make([]byte, len(merged)*8)
+	for i, r := range merged {
+		serializeUint32(buf[i*8:], r[0])
+		serializeUint32(buf[i*8+4:], r[1])
+	}
+	return osutil.WriteFile(filename, buf)
+}
+
+func serializeUint32(buf []byte, v uint32) {
+	for i := 0; i < 4; i++ {
+		buf[i] = byte(v >> (8 * uint(i)))
+	}
+}
+
 func serializeUint64(buf []byte, v uint64) {
 	for i := 0; i < 8; i++ {
 		buf[i] = byte(v >> (8 * uint(i)))
@@ -4,6 +4,8 @@
 package ipc
 
 import (
+	"bytes"
+	"io/ioutil"
 	"math/rand"
 	"os"
 	"path/filepath"
@@ -107,3 +109,29 @@ func TestExecute(t *testing.T) {
 		}
 	}
 }
+
+func TestWriteCoverFilter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "syz-ipc-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "filter")
+	if err := WriteCoverFilter(file, [][2]uint32{{0x300, 0x400}, {0x100, 0x200}, {0x150, 0x250}, {0x250, 0x260}}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{
+		0x00, 0x01, 0, 0, 0x60, 0x02, 0, 0,
+		0x00, 0x03, 0, 0, 0x00, 0x04, 0, 0,
+	}
+	if !bytes.Equal(data, want) {
+		t.Fatalf("got filter %x, want %x", data, want)
+	}
+	if err := WriteCoverFilter(file, nil); err == nil {
+		t.Fatalf("writing of empty filter did not fail")
+	}
+}
@@ -413,6 +413,37 @@ func (ctx *context) minimizeProg(res *Result) (*Result, error) {
 	return res, nil
 }
 
+// replaceCollide tries to reproduce the crash with all calls marked as async
+// instead of collide mode, and then leaves only the necessary async calls.
+func (ctx *context) replaceCollide(res *Result, opts csource.Options) error {
+	p := res.Prog.Clone()
+	for _, c := range p.Calls[:len(p.Calls)-1] {
+		c.Async = true
+	}
+	crashed, err := ctx.testProg(p, res.Duration, opts)
+	if err != nil || !crashed {
+		return err
+	}
+	ctx.reproLog(2, "replaced collide mode with async calls")
+	for i := range p.Calls {
+		if !p.Calls[i].Async {
+			continue
+		}
+		p1 := p.Clone()
+		p1.Calls[i].Async = false
+		crashed, err := ctx.testProg(p1, res.Duration, opts)
+		if err != nil {
+			return err
+		}
+		if crashed {
+			p = p1
+		}
+	}
+	res.Prog = p
+	res.Opts = opts
+	return nil
+}
+
 // Simplify repro options (threaded, collide, sandbox, etc).
 func (ctx *context) simplifyProg(res *Result) (*Result, error) {
 	ctx.reproLog(2, "simplifying guilty program")
@@ -437,6 +468,12 @@ func (ctx *context) simplifyProg(res *Result) (*Result, error) {
 		if crashed {
 			res.Opts = opts
 		}
+	} else if res.Opts.Collide && len(res.Prog.Calls) > 1 {
+		// The crash needs concurrency. Collide mode is random,
+		// so try to replace it with explicit async calls.
+		if err := ctx.replaceCollide(res, opts); err != nil {
+			return res, err
+		}
 	}
 	if res.Opts.Sandbox == "namespace" {
 		opts = res.Opts
@@ -4,7 +4,9 @@
 package rpctype
 
 import (
+	"compress/flate"
 	"fmt"
+	"io"
 	"net"
 	"net/rpc"
 	"time"
@@ -13,11 +15,14 @@ import (
 )
 
 type RpcServer struct {
-	ln net.Listener
-	s  *rpc.Server
+	ln             net.Listener
+	s              *rpc.Server
+	useCompression bool
 }
 
-func NewRpcServer(addr string, receiver interface{}) (*RpcServer, error) {
+// NewRpcServer creates a server for receiver. If useCompression is set,
+// connections are compressed and clients must also use compression.
+func NewRpcServer(addr string, receiver interface{}, useCompression bool) (*RpcServer, error) {
 	ln, err := net.Listen("tcp", addr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to listen on %v: %v", addr, err)
@@ -25,8 +30,9 @@ func NewRpcServer(addr string, receiver interface{}) (*RpcServer, error) {
 	s := rpc.NewServer()
 	s.Register(receiver)
 	serv := &RpcServer{
-		ln: ln,
-		s:  s,
+		ln:             ln,
+		s:              s,
+		useCompression: useCompression,
 	}
 	return serv, nil
 }
@@ -40,7 +46,11 @@ func (serv *RpcServer) Serve() {
 		}
 		conn.(*net.TCPConn).SetKeepAlive(true)
 		conn.(*net.TCPConn).SetKeepAlivePeriod(time.Minute)
-		go serv.s.ServeConn(conn)
+		var rwc io.ReadWriteCloser = conn
+		if serv.useCompression {
+			rwc = newFlateConn(conn)
+		}
+		go serv.s.ServeConn(rwc)
 	}
 }
 
@@ -53,16 +63,20 @@ type RpcClient struct {
 	c    *rpc.Client
 }
 
-func NewRpcClient(addr string) (*RpcClient, error) {
+func NewRpcClient(addr string, useCompression bool) (*RpcClient, error) {
 	conn, err := net.DialTimeout("tcp", addr, 60*time.Second)
 	if err != nil {
 		return nil, err
 	}
 	conn.(*net.TCPConn).SetKeepAlive(true)
 	conn.(*net.TCPConn).SetKeepAlivePeriod(time.Minute)
+	var rwc io.ReadWriteCloser = conn
+	if useCompression {
+		rwc = newFlateConn(conn)
+	}
 	cli := &RpcClient{
 		conn: conn,
-		c:    rpc.NewClient(conn),
+		c:    rpc.NewClient(rwc),
 	}
 	return cli, nil
 }
@@ -78,11 +92,62 @@ func (cli *RpcClient) Close() {
 	cli.c.Close()
 }
 
-func RpcCall(addr, method string, args, reply interface{}) error {
-	c, err := NewRpcClient(addr)
+func RpcCall(addr string, useCompression bool, method string, args, reply interface{}) error {
+	c, err := NewRpcClient(addr, useCompression)
 	if err != nil {
 		return err
 	}
 	defer c.Close()
 	return c.Call(method, args, reply)
 }
+
+// flateConn compresses data sent over conn. Every write is flushed,
+// since net/rpc codecs buffer and flush whole messages themselves.
+type flateConn struct {
+	r io.ReadCloser
+	w *flate.Writer
+	c io.Closer
+}
+
+func newFlateConn(conn io.ReadWriteCloser) io.ReadWriteCloser {
+	// Signal is already compactly encoded and the manager serves lots of fuzzers,
+	// so we prefer speed over compression ratio.
+	w, err := flate.NewWriter(conn, flate.BestSpeed)
+	if err != nil {
+		panic(err)
+	}
+	return &flateConn{
+		r: flate.NewReader(conn),
+		w: w,
+		c: conn,
+	}
+}
+
+func (fc *flateConn) Read(data []byte) (int, error) {
+	return fc.r.Read(data)
+}
+
+func (fc *flateConn) Write(data []byte) (int, error) {
+	n, err := fc.w.Write(data)
+	if err != nil {
+		return n, err
+	}
+	if err := fc.w.Flush(); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+func (fc *flateConn) Close() error {
+	var err0 error
+	if err := fc.r.Close(); err != nil {
+		err0 = err
+	}
+	if err := fc.w.Close(); err != nil {
+		err0 = err
+	}
+	if err := fc.c.Close(); err != nil {
+		err0 = err
+	}
+	return err0
+}
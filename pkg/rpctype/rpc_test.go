@@ -0,0 +1,41 @@
+// Copyright 2017 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package rpctype
+
+import (
+	"reflect"
+	"testing"
+)
+
+type TestReceiver struct{}
+
+func (TestReceiver) Poll(a *PollArgs, r *PollRes) error {
+	r.MaxSignal = a.MaxSignal
+	return nil
+}
+
+func TestRpcCompression(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		serv, err := NewRpcServer("localhost:0", TestReceiver{}, compress)
+		if err != nil {
+			t.Fatal(err)
+		}
+		go serv.Serve()
+		cli, err := NewRpcClient(serv.Addr().String(), compress)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 3; i++ {
+			a := &PollArgs{MaxSignal: Signal{uint32(i), 1000, 1 << 20}}
+			r := new(PollRes)
+			if err := cli.Call("TestReceiver.Poll", a, r); err != nil {
+				t.Fatalf("compress=%v: call failed: %v", compress, err)
+			}
+			if !reflect.DeepEqual(r.MaxSignal, a.MaxSignal) {
+				t.Fatalf("compress=%v: got %v, want %v", compress, r.MaxSignal, a.MaxSignal)
+			}
+		}
+		cli.Close()
+	}
+}
@@ -5,12 +5,20 @@
 // between various parts of the system.
 package rpctype
 
+// ProtocolVersion is the version of manager/fuzzer RPC protocol.
+// It needs to be bumped on any incompatible change to the types below.
+const ProtocolVersion = 1
+
+// NotConnectedError is the prefix of the error that manager returns on calls from unknown fuzzers
+// (this happens if manager was restarted), such fuzzers need to reconnect.
+const NotConnectedError = "fuzzer is not connected"
+
 type RpcInput struct {
 	Call      string
 	Prog      []byte
 	CallIndex int
-	Signal    []uint32
-	Cover     []uint32
+	Signal    Signal
+	Cover     Signal
 }
 
 type RpcCandidate struct {
@@ -19,16 +27,23 @@ type RpcCandidate struct {
 }
 
 type ConnectArgs struct {
-	Name string
+	Name      string
+	Version   int  // ProtocolVersion of the fuzzer
+	Reconnect bool // the fuzzer lost connection to manager and connects again
 }
 
 type ConnectRes struct {
+	Version      int // ProtocolVersion of the manager
 	Prios        [][]float32
 	Inputs       []RpcInput
-	MaxSignal    []uint32
+	MaxSignal    Signal
 	Candidates   []RpcCandidate
 	EnabledCalls string
 	NeedCheck    bool
+	Dict         []byte         // user value dictionary (see prog.ParseDict)
+	Targets      map[uint32]int // coverage PC -> distance to fuzzing targets
+	CoverFilter  [][2]uint32    // [start, end) PC ranges that restrict feedback signal
+	FlakySignal  Signal         // signal classified as flaky (full set)
 }
 
 type CheckArgs struct {
@@ -46,15 +61,34 @@ type NewInputArgs struct {
 }
 
 type PollArgs struct {
-	Name      string
-	MaxSignal []uint32
-	Stats     map[string]uint64
+	Name         string
+	MaxSignal    Signal
+	FlakySignal  Signal // signal that was not reproduced during triage
+	Stats        map[string]uint64
+	FailingCalls []FailingCall         // syscalls that never succeed in the fuzzer (full set)
+	CallStats    map[string]*CallStats // per-syscall stats since the previous poll
+}
+
+type CallStats struct {
+	Execs   uint64
+	Success uint64
+	Errnos  map[int]uint64 // errno -> number of failures
+	Signal  uint64         // new signal found by the syscall
+	Flaky   uint64         // signal of the syscall that was not reproduced during triage
+}
+
+type FailingCall struct {
+	Name  string
+	Execs uint64
+	Errno int // most frequent errno
 }
 
 type PollRes struct {
-	Candidates []RpcCandidate
-	NewInputs  []RpcInput
-	MaxSignal  []uint32
+	Candidates  []RpcCandidate
+	NewInputs   []RpcInput
+	MaxSignal   Signal
+	FlakySignal Signal         // signal newly classified as flaky
+	Targets     map[uint32]int // sent once, when fuzzing targets are resolved
 }
 
 type HubConnectArgs struct {
@@ -0,0 +1,134 @@
+// Copyright 2017 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package rpctype
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// Signal is a set of signal or coverage elements sent over RPC.
+// It is serialized compactly instead of as a plain gob array:
+// elements are sorted and encoded either as varint deltas
+// or as a bitmap (whatever is smaller), so the order and duplicates
+// are not preserved.
+type Signal []uint32
+
+const (
+	signalDelta  = 0
+	signalBitmap = 1
+)
+
+func (s Signal) GobEncode() ([]byte, error) {
+	sorted := make([]uint32, len(s))
+	copy(sorted, s)
+	sort.Sort(uint32Array(sorted))
+	n := 0
+	for i, v := range sorted {
+		if i == 0 || v != sorted[n-1] {
+			sorted[n] = v
+			n++
+		}
+	}
+	sorted = sorted[:n]
+	delta := encodeSignalDelta(sorted)
+	if len(sorted) != 0 {
+		min, max := sorted[0], sorted[len(sorted)-1]
+		if uint64(max-min)/8+1+binary.MaxVarintLen32 < uint64(len(delta)) {
+			return encodeSignalBitmap(sorted), nil
+		}
+	}
+	return delta, nil
+}
+
+func (s *Signal) GobDecode(data []byte) error {
+	if len(data) == 0 {
+		return fmt.Errorf("empty signal")
+	}
+	switch data[0] {
+	case signalDelta:
+		return s.decodeDelta(data[1:])
+	case signalBitmap:
+		return s.decodeBitmap(data[1:])
+	default:
+		return fmt.Errorf("unknown signal encoding %v", data[0])
+	}
+}
+
+func encodeSignalDelta(sorted []uint32) []byte {
+	buf := make([]byte, 1, 1+binary.MaxVarintLen32*(len(sorted)+1))
+	buf[0] = signalDelta
+	var tmp [binary.MaxVarintLen32]byte
+	buf = append(buf, tmp[:binary.PutUvarint(tmp[:], uint64(len(sorted)))]...)
+	prev := uint32(0)
+	for _, v := range sorted {
+		buf = append(buf, tmp[:binary.PutUvarint(tmp[:], uint64(v-prev))]...)
+		prev = v
+	}
+	return buf
+}
+
+func (s *Signal) decodeDelta(data []byte) error {
+	n, size := binary.Uvarint(data)
+	if size <= 0 || n > uint64(len(data)) {
+		return fmt.Errorf("bad signal size")
+	}
+	data = data[size:]
+	res := make(Signal, 0, n)
+	prev := uint64(0)
+	for i := uint64(0); i < n; i++ {
+		d, size := binary.Uvarint(data)
+		if size <= 0 || prev+d > 1<<32-1 {
+			return fmt.Errorf("bad signal element %v", i)
+		}
+		data = data[size:]
+		prev += d
+		res = append(res, uint32(prev))
+	}
+	*s = res
+	return nil
+}
+
+func encodeSignalBitmap(sorted []uint32) []byte {
+	min, max := sorted[0], sorted[len(sorted)-1]
+	buf := make([]byte, 1, 1+binary.MaxVarintLen32+int(max-min)/8+1)
+	buf[0] = signalBitmap
+	var tmp [binary.MaxVarintLen32]byte
+	buf = append(buf, tmp[:binary.PutUvarint(tmp[:], uint64(min))]...)
+	bitmap := make([]byte, int(max-min)/8+1)
+	for _, v := range sorted {
+		bitmap[(v-min)/8] |= 1 << ((v - min) % 8)
+	}
+	return append(buf, bitmap...)
+}
+
+func (s *Signal) decodeBitmap(data []byte) error {
+	min, size := binary.Uvarint(data)
+	if size <= 0 || min > 1<<32-1 {
+		return fmt.Errorf("bad signal bitmap")
+	}
+	var res Signal
+	for i, b := range data[size:] {
+		for bit := uint64(0); b != 0; bit++ {
+			if b&(1<<bit) == 0 {
+				continue
+			}
+			v := min + uint64(i)*8 + bit
+			if v > 1<<32-1 {
+				return fmt.Errorf("bad signal bitmap")
+			}
+			res = append(res, uint32(v))
+			b &^= 1 << bit
+		}
+	}
+	*s = res
+	return nil
+}
+
+type uint32Array []uint32
+
+func (a uint32Array) Len() int           { return len(a) }
+func (a uint32Array) Less(i, j int) bool { return a[i] < a[j] }
+func (a uint32Array) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
@@ -0,0 +1,85 @@
+// Copyright 2017 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package rpctype
+
+import (
+	"bytes"
+	"encoding/gob"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSignalEncoding(t *testing.T) {
+	rs := rand.NewSource(0)
+	r := rand.New(rs)
+	var tests []Signal
+	tests = append(tests,
+		Signal{0},
+		Signal{1<<32 - 1},
+		Signal{0, 1<<32 - 1},
+		Signal{5, 3, 3, 1},
+	)
+	dense := Signal{}
+	for i := 0; i < 1000; i++ {
+		dense = append(dense, 0xffffff00+uint32(r.Intn(0x100)))
+	}
+	tests = append(tests, dense)
+	for i := 0; i < 100; i++ {
+		var s Signal
+		for n := r.Intn(1000); n > 0; n-- {
+			s = append(s, r.Uint32())
+		}
+		tests = append(tests, s)
+	}
+	for i, s := range tests {
+		data, err := s.GobEncode()
+		if err != nil {
+			t.Fatalf("#%v: failed to encode: %v", i, err)
+		}
+		var s1 Signal
+		if err := s1.GobDecode(data); err != nil {
+			t.Fatalf("#%v: failed to decode: %v", i, err)
+		}
+		want := canonicalSignal(s)
+		if !reflect.DeepEqual(want, s1) {
+			t.Fatalf("#%v: signal is corrupted:\nwant: %v\ngot:  %v", i, want, s1)
+		}
+	}
+	if data, _ := dense.GobEncode(); data[0] != signalBitmap {
+		t.Fatalf("dense signal is not encoded as bitmap")
+	}
+}
+
+func TestSignalGob(t *testing.T) {
+	args := &PollArgs{
+		Name:      "fuzzer",
+		MaxSignal: Signal{3, 2, 1},
+	}
+	buf := new(bytes.Buffer)
+	if err := gob.NewEncoder(buf).Encode(args); err != nil {
+		t.Fatal(err)
+	}
+	args1 := new(PollArgs)
+	if err := gob.NewDecoder(buf).Decode(args1); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(args1.MaxSignal, Signal{1, 2, 3}) || args1.FlakySignal != nil {
+		t.Fatalf("bad decoded args: %+v", args1)
+	}
+}
+
+func canonicalSignal(s Signal) Signal {
+	res := append(Signal{}, s...)
+	sort.Sort(uint32Array(res))
+	n := 0
+	for i, v := range res {
+		if i == 0 || v != res[n-1] {
+			res[n] = v
+			n++
+		}
+	}
+	return res[:n]
+}
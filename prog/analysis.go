@@ -10,6 +10,7 @@ package prog
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/google/syzkaller/sys"
 )
@@ -24,6 +25,12 @@ type state struct {
 	resources map[string][]*Arg
 	strings   map[string]bool
 	pages     [maxPages]bool
+	// Sorted keys of the maps above. Random choices are made from these lists
+	// rather than from map iteration, so that generation and mutation
+	// are deterministic for a given random source (see MutateTraced).
+	fileList     []string
+	stringList   []string
+	resourceList []string
 }
 
 // analyze analyzes the program p up to but not including call c.
@@ -53,16 +60,16 @@ func (s *state) analyze(c *Call) {
 		switch typ := arg.Type.(type) {
 		case *sys.ResourceType:
 			if arg.Type.Dir() != sys.DirIn {
-				s.resources[typ.Desc.Name] = append(s.resources[typ.Desc.Name], arg)
+				s.addResource(typ.Desc.Name, arg)
 				// TODO: negative PIDs and add them as well (that's process groups).
 			}
 		case *sys.BufferType:
 			if arg.Type.Dir() != sys.DirOut && arg.Kind == ArgData && len(arg.Data) != 0 {
 				switch typ.Kind {
 				case sys.BufferString:
-					s.strings[string(arg.Data)] = true
+					addSorted(s.strings, &s.stringList, string(arg.Data))
 				case sys.BufferFilename:
-					s.files[string(arg.Data)] = true
+					addSorted(s.files, &s.fileList, string(arg.Data))
 				}
 			}
 		}
@@ -87,7 +94,7 @@ func (s *state) analyze(c *Call) {
 			for _, ptr := range arr.Inner {
 				if ptr.Kind == ArgPointer {
 					if ptr.Res != nil && ptr.Res.Type.Name() == "iocb" {
-						s.resources["iocbptr"] = append(s.resources["iocbptr"], ptr)
+						s.addResource("iocbptr", ptr)
 					}
 				}
 			}
@@ -95,6 +102,29 @@ func (s *state) analyze(c *Call) {
 	}
 }
 
+func (s *state) addResource(kind string, arg *Arg) {
+	if _, ok := s.resources[kind]; !ok {
+		insertSorted(&s.resourceList, kind)
+	}
+	s.resources[kind] = append(s.resources[kind], arg)
+}
+
+// addSorted adds key to set m and to the sorted list of its keys.
+func addSorted(m map[string]bool, list *[]string, key string) {
+	if m[key] {
+		return
+	}
+	m[key] = true
+	insertSorted(list, key)
+}
+
+func insertSorted(list *[]string, key string) {
+	i := sort.SearchStrings(*list, key)
+	*list = append(*list, "")
+	copy((*list)[i+1:], (*list)[i:])
+	(*list)[i] = key
+}
+
 func (s *state) addressable(addr, size *Arg, ok bool) {
 	if addr.Kind != ArgPointer || size.Kind != ArgPageSize {
 		panic("mmap/munmap/mremap args are not pages")
@@ -150,6 +180,39 @@ func foreachArg(c *Call, f func(arg, base *Arg, parent *[]*Arg)) {
 	foreachArgArray(&c.Args, nil, f)
 }
 
+// foreachArgPath invokes f for all args of call c (including the return value)
+// along with human-readable paths to them (see argPath).
+func foreachArgPath(c *Call, f func(arg *Arg, path string)) {
+	var rec func(arg *Arg, path string)
+	rec = func(arg *Arg, path string) {
+		if arg == nil {
+			return
+		}
+		f(arg, path)
+		switch arg.Kind {
+		case ArgPointer:
+			rec(arg.Res, path+"*")
+		case ArgGroup:
+			_, isArray := arg.Type.(*sys.ArrayType)
+			for i, inner := range arg.Inner {
+				if isArray {
+					rec(inner, fmt.Sprintf("%v[%v]", path, i))
+				} else {
+					rec(inner, path+"."+fieldName(inner.Type, i))
+				}
+			}
+		case ArgUnion:
+			rec(arg.Option, path+"."+fieldName(arg.OptionType, 0))
+		}
+	}
+	for i, arg := range c.Args {
+		rec(arg, fieldName(arg.Type, i))
+	}
+	if c.Ret != nil {
+		rec(c.Ret, "ret")
+	}
+}
+
 func foreachSubargOffset(arg *Arg, f func(arg *Arg, offset uintptr)) {
 	var rec func(*Arg, uintptr) uintptr
 	rec = func(arg1 *Arg, offset uintptr) uintptr {
@@ -0,0 +1,197 @@
+// Copyright 2017 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"syscall"
+	"unicode"
+
+	"github.com/google/syzkaller/sys"
+)
+
+// CallResult is the result of a call execution shown in annotated programs.
+type CallResult struct {
+	Errno         int // -1 if the call was not executed
+	FaultInjected bool
+}
+
+// Annotate returns a human-readable rendering of the program.
+// Unlike Serialize, it prints names of args and struct fields, names of flags
+// and printable data as strings. If results is not nil, every call
+// is followed by its result (results[i] corresponds to p.Calls[i]).
+// The output is meant for reading only and can't be deserialized.
+func (p *Prog) Annotate(results []CallResult) []byte {
+	buf := new(bytes.Buffer)
+	vars := make(map[*Arg]int)
+	varSeq := 0
+	for ci, c := range p.Calls {
+		if len(c.Ret.Uses) != 0 {
+			fmt.Fprintf(buf, "r%v = ", varSeq)
+			vars[c.Ret] = varSeq
+			varSeq++
+		}
+		fmt.Fprintf(buf, "%v(", c.Meta.Name)
+		first := true
+		for _, a := range c.Args {
+			if sys.IsPad(a.Type) {
+				continue
+			}
+			if !first {
+				fmt.Fprintf(buf, ", ")
+			}
+			first = false
+			annotateField(buf, a)
+			a.annotate(buf, vars, &varSeq)
+		}
+		fmt.Fprintf(buf, ")")
+		if c.Async {
+			fmt.Fprintf(buf, " (async)")
+		}
+		if ci < len(results) {
+			fmt.Fprintf(buf, " # %v", results[ci])
+		}
+		fmt.Fprintf(buf, "\n")
+	}
+	return buf.Bytes()
+}
+
+func (res CallResult) String() string {
+	var s string
+	switch res.Errno {
+	case -1:
+		s = "not executed"
+	case 0:
+		s = "ok"
+	default:
+		s = fmt.Sprintf("errno %v (%v)", res.Errno, syscall.Errno(res.Errno))
+	}
+	if res.FaultInjected {
+		s += ", fault injected"
+	}
+	return s
+}
+
+func annotateField(buf io.Writer, a *Arg) {
+	if a != nil && a.Type.FieldName() != "" {
+		fmt.Fprintf(buf, "%v=", a.Type.FieldName())
+	}
+}
+
+func (a *Arg) annotate(buf io.Writer, vars map[*Arg]int, varSeq *int) {
+	if a == nil {
+		fmt.Fprintf(buf, "nil")
+		return
+	}
+	if len(a.Uses) != 0 {
+		fmt.Fprintf(buf, "<r%v=>", *varSeq)
+		vars[a] = *varSeq
+		*varSeq++
+	}
+	switch a.Kind {
+	case ArgConst:
+		if typ, ok := a.Type.(*sys.FlagsType); ok {
+			fmt.Fprintf(buf, "%v", flagsString(typ, a.Val))
+		} else {
+			fmt.Fprintf(buf, "0x%x", a.Val)
+		}
+	case ArgResult:
+		id, ok := vars[a.Res]
+		if !ok {
+			panic("no result")
+		}
+		fmt.Fprintf(buf, "r%v", id)
+		if a.OpDiv != 0 {
+			fmt.Fprintf(buf, "/%v", a.OpDiv)
+		}
+		if a.OpAdd != 0 {
+			fmt.Fprintf(buf, "+%v", a.OpAdd)
+		}
+	case ArgPointer:
+		fmt.Fprintf(buf, "&%v=", serializeAddr(a, true))
+		a.Res.annotate(buf, vars, varSeq)
+	case ArgPageSize:
+		fmt.Fprintf(buf, "%v", serializeAddr(a, false))
+	case ArgData:
+		if isPrintable(a.Data) {
+			fmt.Fprintf(buf, "%v", strconv.Quote(string(a.Data)))
+		} else {
+			fmt.Fprintf(buf, "x\"%v\"", hex.EncodeToString(a.Data))
+		}
+	case ArgGroup:
+		_, isStruct := a.Type.(*sys.StructType)
+		if isStruct {
+			fmt.Fprintf(buf, "{")
+		} else {
+			fmt.Fprintf(buf, "[")
+		}
+		first := true
+		for _, a1 := range a.Inner {
+			if a1 != nil && sys.IsPad(a1.Type) {
+				continue
+			}
+			if !first {
+				fmt.Fprintf(buf, ", ")
+			}
+			first = false
+			if isStruct {
+				annotateField(buf, a1)
+			}
+			a1.annotate(buf, vars, varSeq)
+		}
+		if isStruct {
+			fmt.Fprintf(buf, "}")
+		} else {
+			fmt.Fprintf(buf, "]")
+		}
+	case ArgUnion:
+		fmt.Fprintf(buf, "@%v=", a.OptionType.FieldName())
+		a.Option.annotate(buf, vars, varSeq)
+	default:
+		panic("unknown arg kind")
+	}
+}
+
+// flagsString returns symbolic representation of flags value v,
+// e.g. "O_RDWR|O_CREAT" or "FOO|0x100" if some bits don't have names.
+func flagsString(typ *sys.FlagsType, v uintptr) string {
+	if len(typ.ValNames) != len(typ.Vals) {
+		return fmt.Sprintf("0x%x", v)
+	}
+	for i, fv := range typ.Vals {
+		if fv == v {
+			return typ.ValNames[i]
+		}
+	}
+	var names []string
+	rem := v
+	for i, fv := range typ.Vals {
+		if fv != 0 && rem&fv == fv {
+			names = append(names, typ.ValNames[i])
+			rem &^= fv
+		}
+	}
+	if rem != 0 || len(names) == 0 {
+		names = append(names, fmt.Sprintf("0x%x", rem))
+	}
+	return strings.Join(names, "|")
+}
+
+// isPrintable returns true if data looks like a string (possibly NUL-terminated).
+func isPrintable(data []byte) bool {
+	if len(data) != 0 && data[len(data)-1] == 0 {
+		data = data[:len(data)-1]
+	}
+	for _, v := range data {
+		if v >= 0x80 || !unicode.IsPrint(rune(v)) && v != '\t' && v != '\n' {
+			return false
+		}
+	}
+	return true
+}
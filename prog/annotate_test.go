@@ -0,0 +1,53 @@
+// Copyright 2017 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"testing"
+)
+
+func TestAnnotateRandom(t *testing.T) {
+	rs, iters := initTest(t)
+	for i := 0; i < iters; i++ {
+		p := Generate(rs, 10, nil)
+		results := make([]CallResult, len(p.Calls))
+		p.Annotate(results)
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	tests := []struct {
+		prog    string
+		results []CallResult
+		want    string
+	}{
+		{
+			"r0 = open(&(0x7f0000001000)=\"2e2f66696c653000\", 0x42, 0x0)\n" +
+				"read(r0, &(0x7f0000000000)=\"\", 0x1)\n",
+			[]CallResult{{Errno: 0}, {Errno: 9}},
+			"r0 = open(file=&(0x7f0000001000)=\"./file0\\x00\", flags=O_RDWR|O_CREAT, mode=0x0) # ok\n" +
+				"read(fd=r0, buf=&(0x7f0000000000)=\"\", count=0x1) # errno 9 (bad file descriptor)\n",
+		},
+		{
+			"writev(0xffffffffffffffff, &(0x7f0000000000)=[{&(0x7f0000001000)=\"ff\", 0x1}], 0x1)\n",
+			[]CallResult{{Errno: -1, FaultInjected: true}},
+			"writev(fd=0xffffffffffffffff, vec=&(0x7f0000000000)=[{addr=&(0x7f0000001000)=x\"ff\", len=0x1}], vlen=0x1)" +
+				" # not executed, fault injected\n",
+		},
+		{
+			"r0 = open(&(0x7f0000001000)=\"2e2f66696c653000\", 0x40000002, 0x0) (async)\n",
+			nil,
+			"open(file=&(0x7f0000001000)=\"./file0\\x00\", flags=O_RDWR|0x40000000, mode=0x0) (async)\n",
+		},
+	}
+	for i, test := range tests {
+		p, err := Deserialize([]byte(test.prog))
+		if err != nil {
+			t.Fatalf("#%v: failed to deserialize: %v", i, err)
+		}
+		if got := string(p.Annotate(test.results)); got != test.want {
+			t.Fatalf("#%v: got:\n%v\nwant:\n%v", i, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2017 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"github.com/google/syzkaller/pkg/hash"
+	"github.com/google/syzkaller/sys"
+)
+
+// Canonicalize returns a copy of p in canonical form. Programs that differ only
+// in things that don't affect execution have the same canonical form:
+// pointers into pages that the program never maps are renumbered in the order
+// of first use (so only aliasing of such pages is preserved, offsets within pages
+// are kept as is), values of output args, padding and checksums are reset,
+// and result variables are renumbered during serialization anyway.
+// Pages mapped by the program (and pages adjacent to them) are not renumbered,
+// so that the mapped/unmapped relation of all pointers is preserved.
+// The canonical program is intended for hashing and comparison, not for execution.
+func (p *Prog) Canonicalize() *Prog {
+	p1 := p.Clone()
+	mapped := mappedPages(p1)
+	pages := make(map[uintptr]uintptr)
+	next := uintptr(0)
+	page := func(v uintptr) uintptr {
+		if mapped[v] {
+			return v
+		}
+		if res, ok := pages[v]; ok {
+			return res
+		}
+		for mapped[next] {
+			next++
+		}
+		res := next
+		next++
+		pages[v] = res
+		return res
+	}
+	for _, c := range p1.Calls {
+		foreachArg(c, func(arg, _ *Arg, _ *[]*Arg) {
+			switch arg.Kind {
+			case ArgPointer:
+				arg.AddrPage = page(arg.AddrPage)
+			case ArgConst:
+				switch typ := arg.Type.(type) {
+				case *sys.CsumType:
+					arg.Val = 0
+				case *sys.ConstType:
+					if typ.IsPad {
+						arg.Val = 0
+					}
+				case *sys.LenType:
+				default:
+					if typ.Dir() == sys.DirOut {
+						arg.Val = typ.Default()
+					}
+				}
+			case ArgData:
+				if arg.Type.Dir() == sys.DirOut {
+					arg.Data = make([]byte, len(arg.Data))
+				}
+			}
+		})
+	}
+	return p1
+}
+
+// mappedPages returns pages that are mapped or unmapped by mmap/munmap/mremap calls in p,
+// together with the adjacent pages (accesses to them can cross into the mapped pages).
+func mappedPages(p *Prog) map[uintptr]bool {
+	pages := make(map[uintptr]bool)
+	add := func(addr, size *Arg) {
+		if addr.Kind != ArgPointer || size.Kind != ArgPageSize {
+			return
+		}
+		n := size.AddrPage
+		if size.AddrOffset != 0 {
+			n++
+		}
+		for i := uintptr(0); i < n+2; i++ {
+			if addr.AddrPage+i > 0 {
+				pages[addr.AddrPage+i-1] = true
+			}
+		}
+	}
+	for _, c := range p.Calls {
+		switch c.Meta.CallName {
+		case "mmap", "munmap":
+			if len(c.Args) >= 2 {
+				add(c.Args[0], c.Args[1])
+			}
+		case "mremap":
+			if len(c.Args) >= 5 {
+				add(c.Args[0], c.Args[1])
+				add(c.Args[4], c.Args[2])
+			}
+		}
+	}
+	return pages
+}
+
+// SemanticHash returns hash of the canonical form of the program (see Canonicalize).
+// Unlike hash of the serialized program, it is the same for programs that differ
+// only in addresses, variable numbering, padding and output values.
+func (p *Prog) SemanticHash() hash.Sig {
+	return hash.Hash(p.Canonicalize().Serialize())
+}
+
+// SemanticHashData is SemanticHash for serialized programs.
+// Programs that can't be deserialized don't have a semantic hash.
+func SemanticHashData(data []byte) (hash.Sig, error) {
+	p, err := Deserialize(data)
+	if err != nil {
+		return hash.Sig{}, err
+	}
+	return p.SemanticHash(), nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2017 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCanonicalizeRandom(t *testing.T) {
+	rs, iters := initTest(t)
+	for i := 0; i < iters; i++ {
+		p := Generate(rs, 10, nil)
+		data := p.Serialize()
+		p1 := p.Canonicalize()
+		if data1 := p.Serialize(); !bytes.Equal(data, data1) {
+			t.Fatalf("program changed after canonicalization\noriginal:\n%s\n\nnew:\n%s\n", data, data1)
+		}
+		if err := p1.validate(); err != nil {
+			t.Fatalf("canonical program is invalid: %v\n%s", err, p1.Serialize())
+		}
+		if canon, canon1 := p1.Serialize(), p1.Canonicalize().Serialize(); !bytes.Equal(canon, canon1) {
+			t.Fatalf("canonicalization is not idempotent\nfirst:\n%s\n\nsecond:\n%s\n", canon, canon1)
+		}
+		if sig, err := SemanticHashData(data); err != nil || sig != p.SemanticHash() {
+			t.Fatalf("SemanticHashData differs from SemanticHash (err: %v)", err)
+		}
+	}
+}
+
+func TestSemanticHash(t *testing.T) {
+	tests := []struct {
+		p1, p2 string
+		equal  bool
+	}{
+		{
+			// Different addresses.
+			"r0 = open(&(0x7f0000001000)=\"2e2f66696c653000\", 0x0, 0x0)\n" +
+				"read(r0, &(0x7f0000000000)=\"\", 0x1)\n",
+			"r0 = open(&(0x7f0000005000)=\"2e2f66696c653000\", 0x0, 0x0)\n" +
+				"read(r0, &(0x7f0000003000)=\"\", 0x1)\n",
+			true,
+		},
+		{
+			// Different variable numbering.
+			"r5 = open(&(0x7f0000001000)=\"2e2f66696c653000\", 0x0, 0x0)\n" +
+				"read(r5, &(0x7f0000000000)=\"\", 0x1)\n",
+			"r0 = open(&(0x7f0000001000)=\"2e2f66696c653000\", 0x0, 0x0)\n" +
+				"read(r0, &(0x7f0000000000)=\"\", 0x1)\n",
+			true,
+		},
+		{
+			// Different output values.
+			"pipe(&(0x7f0000000000)={0x0, 0x0})\n",
+			"pipe(&(0x7f0000000000)={<r0=>0xffffffffffffffff, 0x0})\n",
+			true,
+		},
+		{
+			// Aliasing of pointers is preserved.
+			"r0 = open(&(0x7f0000001000)=\"2e2f66696c653000\", 0x0, 0x0)\n" +
+				"read(r0, &(0x7f0000001000)=\"\", 0x1)\n",
+			"r0 = open(&(0x7f0000001000)=\"2e2f66696c653000\", 0x0, 0x0)\n" +
+				"read(r0, &(0x7f0000000000)=\"\", 0x1)\n",
+			false,
+		},
+		{
+			// Pointer into a mapped page vs pointer into an unmapped page.
+			"mmap(&(0x7f0000000000/0x3000)=nil, (0x3000), 0x3, 0x32, 0xffffffffffffffff, 0x0)\n" +
+				"pipe(&(0x7f0000002000)={0x0, 0x0})\n",
+			"mmap(&(0x7f0000000000/0x3000)=nil, (0x3000), 0x3, 0x32, 0xffffffffffffffff, 0x0)\n" +
+				"pipe(&(0x7f0000009000)={0x0, 0x0})\n",
+			false,
+		},
+		{
+			// Different mapping sizes.
+			"mmap(&(0x7f0000000000/0x3000)=nil, (0x3000), 0x3, 0x32, 0xffffffffffffffff, 0x0)\n",
+			"mmap(&(0x7f0000000000/0x1000)=nil, (0x1000), 0x3, 0x32, 0xffffffffffffffff, 0x0)\n",
+			false,
+		},
+		{
+			// Different unmapped pages.
+			"mmap(&(0x7f0000000000/0x1000)=nil, (0x1000), 0x3, 0x32, 0xffffffffffffffff, 0x0)\n" +
+				"pipe(&(0x7f0000005000)={0x0, 0x0})\n",
+			"mmap(&(0x7f0000000000/0x1000)=nil, (0x1000), 0x3, 0x32, 0xffffffffffffffff, 0x0)\n" +
+				"pipe(&(0x7f0000009000)={0x0, 0x0})\n",
+			true,
+		},
+		{
+			// Different values.
+			"r0 = open(&(0x7f0000001000)=\"2e2f66696c653000\", 0x0, 0x0)\n" +
+				"read(r0, &(0x7f0000000000)=\"\", 0x1)\n",
+			"r0 = open(&(0x7f0000001000)=\"2e2f66696c653000\", 0x0, 0x0)\n" +
+				"read(r0, &(0x7f0000000000)=\"\", 0x2)\n",
+			false,
+		},
+	}
+	for i, test := range tests {
+		p1, err := Deserialize([]byte(test.p1))
+		if err != nil {
+			t.Fatalf("#%v: failed to deserialize: %v", i, err)
+		}
+		p2, err := Deserialize([]byte(test.p2))
+		if err != nil {
+			t.Fatalf("#%v: failed to deserialize: %v", i, err)
+		}
+		if equal := p1.SemanticHash() == p2.SemanticHash(); equal != test.equal {
+			t.Fatalf("#%v: hashes equal=%v, want %v\ncanonical 1:\n%s\ncanonical 2:\n%s",
+				i, equal, test.equal, p1.Canonicalize().Serialize(), p2.Canonicalize().Serialize())
+		}
+	}
+}
@@ -9,6 +9,7 @@ func (p *Prog) Clone() *Prog {
 	for _, c := range p.Calls {
 		c1 := new(Call)
 		c1.Meta = c.Meta
+		c1.Async = c.Async
 		c1.Ret = c.Ret.clone(c1, newargs)
 		for _, arg := range c.Args {
 			c1.Args = append(c1.Args, arg.clone(c1, newargs))
@@ -0,0 +1,113 @@
+// Copyright 2017 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"github.com/google/syzkaller/sys"
+)
+
+// crossover splices a random subsequence of calls of p0 into p.
+// Blindly splicing the whole p0 breaks resource flow: calls of p0 are inserted
+// at a random point and the spliced consumers keep using resources
+// produced by p0 calls, while resources created by p are ignored.
+// Instead crossover chooses an insertion point where p has already produced
+// the largest number of resources consumed by the spliced calls, and rewires
+// the spliced consumers to these resources. Consumers whose producers were not
+// spliced and that can't be rewired get default values.
+// p0 is not modified. Returns the insertion index, the number of inserted calls
+// and the number of rewired args.
+func (r *randGen) crossover(p, p0 *Prog, ncalls int) (idx, n, rewired int) {
+	p0c := p0.Clone()
+	end := 1 + r.Intn(len(p0c.Calls))
+	begin := r.Intn(end)
+	if r.oneOf(5) {
+		begin, end = 0, len(p0c.Calls)
+	}
+
+	// Find args of the spliced calls that use resources produced outside of them.
+	produced := make(map[*Arg]bool)
+	var consumers []*Arg
+	for _, c := range p0c.Calls[begin:end] {
+		foreachArgArray(&c.Args, c.Ret, func(arg, _ *Arg, _ *[]*Arg) {
+			produced[arg] = true
+			if _, ok := arg.Type.(*sys.ResourceType); ok && arg.Kind == ArgResult && !produced[arg.Res] {
+				consumers = append(consumers, arg)
+			}
+		})
+	}
+
+	// Choose insertion point that satisfies the most consumers.
+	s := newState(nil)
+	best := -1
+	var candidates []int
+	for i := 0; i <= len(p.Calls); i++ {
+		if i != 0 {
+			s.analyze(p.Calls[i-1])
+		}
+		score := 0
+		for _, arg := range consumers {
+			if len(s.compatibleResources(arg)) != 0 {
+				score++
+			}
+		}
+		if score > best {
+			best = score
+			candidates = nil
+		}
+		if score == best {
+			candidates = append(candidates, i)
+		}
+	}
+	idx = candidates[r.Intn(len(candidates))]
+
+	// Rewire consumers to resources of p.
+	s = newState(nil)
+	for _, c := range p.Calls[:idx] {
+		s.analyze(c)
+	}
+	for _, arg := range consumers {
+		res := s.compatibleResources(arg)
+		if len(res) == 0 {
+			continue
+		}
+		delete(arg.Res.Uses, arg)
+		arg.Res = res[r.Intn(len(res))]
+		if arg.Res.Uses == nil {
+			arg.Res.Uses = make(map[*Arg]bool)
+		}
+		arg.Res.Uses[arg] = true
+		rewired++
+	}
+
+	// Drop calls that are not spliced, this resets the remaining
+	// references to their resources to default values.
+	for i := len(p0c.Calls) - 1; i >= end; i-- {
+		p0c.removeCall(i)
+	}
+	for i := begin - 1; i >= 0; i-- {
+		p0c.removeCall(i)
+	}
+	n = len(p0c.Calls)
+	p.Calls = append(p.Calls[:idx], append(p0c.Calls, p.Calls[idx:]...)...)
+	for i := len(p.Calls) - 1; i >= ncalls; i-- {
+		p.removeCall(i)
+	}
+	return
+}
+
+// compatibleResources returns resources available in the state
+// that can be used by the result arg. Unlike createResource it does not
+// allow passing less specialized resources (e.g. fd instead of sock),
+// since such rewiring would lose the semantics of the spliced calls.
+func (s *state) compatibleResources(arg *Arg) []*Arg {
+	want := arg.Type.(*sys.ResourceType).Desc
+	var res []*Arg
+	for _, kind := range s.resourceList {
+		have := sys.Resources[kind]
+		if len(have.Kind) >= len(want.Kind) && sys.IsCompatibleResource(want.Name, kind) {
+			res = append(res, s.resources[kind]...)
+		}
+	}
+	return res
+}
@@ -0,0 +1,70 @@
+// Copyright 2017 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestCrossoverRandom(t *testing.T) {
+	rs, iters := initTest(t)
+	r := newRand(rs)
+	for i := 0; i < iters; i++ {
+		p := Generate(rs, 10, nil)
+		p0 := Generate(rs, 10, nil)
+		data0 := p0.Serialize()
+		ncalls := len(p.Calls)
+		idx, n, _ := r.crossover(p, p0, 15)
+		if err := p.validate(); err != nil {
+			t.Fatalf("crossover produced invalid program: %v\n%s", err, p.Serialize())
+		}
+		if len(p.Calls) > 15 {
+			t.Fatalf("crossover produced too many calls: %v", len(p.Calls))
+		}
+		if idx > ncalls || n == 0 || n > len(p0.Calls) {
+			t.Fatalf("bad crossover result: idx=%v n=%v", idx, n)
+		}
+		if data := p0.Serialize(); !bytes.Equal(data0, data) {
+			t.Fatalf("crossover changed the source program\noriginal:\n%s\n\nnew:\n%s\n", data0, data)
+		}
+	}
+}
+
+func TestCrossoverRewire(t *testing.T) {
+	p, err := Deserialize([]byte(
+		"sched_yield()\n" +
+			"r0 = open(&(0x7f0000001000)=\"2e2f66696c653000\", 0x0, 0x0)\n" +
+			"sched_yield()\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p0, err := Deserialize([]byte(
+		"r0 = open(&(0x7f0000002000)=\"2e2f66696c653100\", 0x0, 0x0)\n" +
+			"read(r0, &(0x7f0000000000)=\"\", 0x0)\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// When only read is spliced, it must be inserted after open in p and use its fd.
+	tested := false
+	for seed := int64(0); seed < 100; seed++ {
+		p1 := p.Clone()
+		r := newRand(rand.NewSource(seed))
+		idx, n, rewired := r.crossover(p1, p0, 10)
+		if n != 1 || p1.Calls[idx].Meta.Name != "read" {
+			continue
+		}
+		tested = true
+		if rewired != 1 {
+			t.Fatalf("seed %v: rewired %v args, want 1", seed, rewired)
+		}
+		if idx < 2 || p1.Calls[idx].Args[0].Res != p1.Calls[1].Ret {
+			t.Fatalf("seed %v: read is not rewired to open:\n%s", seed, p1.Serialize())
+		}
+	}
+	if !tested {
+		t.Fatalf("read was never spliced alone")
+	}
+}
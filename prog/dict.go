@@ -0,0 +1,166 @@
+// Copyright 2017 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/google/syzkaller/sys"
+)
+
+// Dict is a dictionary of user-supplied interesting values.
+// Generation and mutation use dictionary values for int, flags, string
+// and blob args with probability Prob in addition to values from descriptions.
+type Dict struct {
+	Prob float64
+	DictValues
+	// Keyed holds values for args with the given field or type name.
+	// Keyed values take precedence over global values and are also used
+	// for strings with a fixed set of values.
+	Keyed map[string]*DictValues
+}
+
+type DictValues struct {
+	Ints    []uintptr
+	Strings [][]byte
+	Blobs   [][]byte
+}
+
+const defaultDictProb = 0.1
+
+// jsonDict is the dictionary file format, e.g.:
+//
+//	{
+//		"prob": 0.2,
+//		"ints": ["0x1234", "42"],
+//		"strings": ["eth0"],
+//		"blobs": ["deadbeef"],
+//		"keyed": {
+//			"cmd": {"ints": ["0x5"]},
+//			"devname": {"strings": ["/dev/foo#"]}
+//		}
+//	}
+//
+// Ints are strings to not lose precision, blobs are hex-encoded.
+type jsonDict struct {
+	Prob *float64 `json:"prob"`
+	jsonDictValues
+	Keyed map[string]*jsonDictValues `json:"keyed"`
+}
+
+type jsonDictValues struct {
+	Ints    []string `json:"ints"`
+	Strings []string `json:"strings"`
+	Blobs   []string `json:"blobs"`
+}
+
+// ParseDict parses a dictionary file (see jsonDict for the format).
+func ParseDict(data []byte) (*Dict, error) {
+	jd := new(jsonDict)
+	if err := json.Unmarshal(data, jd); err != nil {
+		return nil, fmt.Errorf("failed to parse dictionary: %v", err)
+	}
+	d := &Dict{
+		Prob:  defaultDictProb,
+		Keyed: make(map[string]*DictValues),
+	}
+	if jd.Prob != nil {
+		d.Prob = *jd.Prob
+		if d.Prob < 0 || d.Prob > 1 {
+			return nil, fmt.Errorf("bad dictionary prob %v, want [0, 1]", d.Prob)
+		}
+	}
+	if err := d.DictValues.parse(&jd.jsonDictValues); err != nil {
+		return nil, err
+	}
+	for key, jv := range jd.Keyed {
+		v := new(DictValues)
+		if err := v.parse(jv); err != nil {
+			return nil, fmt.Errorf("key %v: %v", key, err)
+		}
+		d.Keyed[key] = v
+	}
+	return d, nil
+}
+
+func (v *DictValues) parse(jv *jsonDictValues) error {
+	if jv == nil {
+		return nil
+	}
+	for _, s := range jv.Ints {
+		i, err := strconv.ParseUint(s, 0, 64)
+		if err != nil {
+			return fmt.Errorf("bad dictionary int %q: %v", s, err)
+		}
+		v.Ints = append(v.Ints, uintptr(i))
+	}
+	for _, s := range jv.Strings {
+		v.Strings = append(v.Strings, []byte(s))
+	}
+	for _, s := range jv.Blobs {
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			return fmt.Errorf("bad dictionary blob %q: %v", s, err)
+		}
+		v.Blobs = append(v.Blobs, b)
+	}
+	return nil
+}
+
+// SetDict makes generation and mutation with this choice table use values from dict.
+func (ct *ChoiceTable) SetDict(dict *Dict) {
+	ct.dict = dict
+}
+
+// dictArg returns an arg with a dictionary value for typ,
+// or nil if there are no suitable values or the dictionary is not used this time.
+func (r *randGen) dictArg(s *state, typ sys.Type) *Arg {
+	if s.ct == nil || s.ct.dict == nil || typ.Dir() == sys.DirOut {
+		return nil
+	}
+	d := s.ct.dict
+	if r.Float64() >= d.Prob {
+		return nil
+	}
+	vals, keyed := d.Keyed[typ.FieldName()], true
+	if vals == nil {
+		vals = d.Keyed[typ.Name()]
+	}
+	if vals == nil {
+		vals, keyed = &d.DictValues, false
+	}
+	switch t := typ.(type) {
+	case *sys.IntType, *sys.FlagsType:
+		if len(vals.Ints) != 0 {
+			return constArg(typ, vals.Ints[r.Intn(len(vals.Ints))])
+		}
+	case *sys.BufferType:
+		var cands [][]byte
+		switch t.Kind {
+		case sys.BufferString:
+			if len(t.Values) != 0 && !keyed {
+				break
+			}
+			for _, v := range vals.Strings {
+				if t.Length == 0 || uintptr(len(v)) == t.Length {
+					cands = append(cands, v)
+				}
+			}
+		case sys.BufferBlobRand, sys.BufferBlobRange:
+			for _, v := range vals.Blobs {
+				if t.Kind == sys.BufferBlobRand ||
+					uintptr(len(v)) >= t.RangeBegin && uintptr(len(v)) <= t.RangeEnd {
+					cands = append(cands, v)
+				}
+			}
+		}
+		if len(cands) != 0 {
+			return dataArg(typ, append([]byte{}, cands[r.Intn(len(cands))]...))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+// Copyright 2017 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestParseDict(t *testing.T) {
+	tests := []struct {
+		data string
+		dict *Dict
+	}{
+		{
+			`{}`,
+			&Dict{Prob: defaultDictProb, Keyed: map[string]*DictValues{}},
+		},
+		{
+			`{"prob": 0.5, "ints": ["0x10", "42"], "strings": ["eth0"], "blobs": ["dead"],
+			"keyed": {"cmd": {"ints": ["1"]}}}`,
+			&Dict{
+				Prob: 0.5,
+				DictValues: DictValues{
+					Ints:    []uintptr{0x10, 42},
+					Strings: [][]byte{[]byte("eth0")},
+					Blobs:   [][]byte{{0xde, 0xad}},
+				},
+				Keyed: map[string]*DictValues{
+					"cmd": {Ints: []uintptr{1}},
+				},
+			},
+		},
+		{`{"prob": 2}`, nil},
+		{`{"ints": ["foo"]}`, nil},
+		{`{"blobs": ["xyz"]}`, nil},
+		{`{"keyed": {"cmd": {"ints": ["-"]}}}`, nil},
+		{`[]`, nil},
+	}
+	for i, test := range tests {
+		dict, err := ParseDict([]byte(test.data))
+		if test.dict == nil {
+			if err == nil {
+				t.Fatalf("#%v: parsing did not fail", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("#%v: failed to parse: %v", i, err)
+		}
+		if !reflect.DeepEqual(dict, test.dict) {
+			t.Fatalf("#%v: got dict:\n%+v\nwant:\n%+v", i, dict, test.dict)
+		}
+	}
+}
+
+func TestDictGenerate(t *testing.T) {
+	rs, iters := initTest(t)
+	dict, err := ParseDict([]byte(`{"prob": 0.5, "ints": ["0x1badc0de"], "blobs": ["1badc0de"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct := BuildChoiceTable(CalculatePriorities(nil), nil)
+	ct.SetDict(dict)
+	found := false
+	for i := 0; i < iters && !found; i++ {
+		p := Generate(rs, 10, ct)
+		p.Mutate(rs, 10, ct, nil)
+		if err := p.validate(); err != nil {
+			t.Fatalf("program is invalid: %v\n%s", err, p.Serialize())
+		}
+		data := p.Serialize()
+		found = bytes.Contains(data, []byte("0x1badc0de")) || bytes.Contains(data, []byte("\"1badc0de\""))
+	}
+	if !found {
+		t.Fatalf("dictionary values are not used")
+	}
+}
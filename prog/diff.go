@@ -0,0 +1,212 @@
+// Copyright 2017 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/google/syzkaller/sys"
+)
+
+type DiffKind int
+
+const (
+	DiffCallAdded DiffKind = iota
+	DiffCallRemoved
+	DiffArgChanged
+)
+
+// DiffEntry describes a single difference between two programs.
+type DiffEntry struct {
+	Kind DiffKind
+	// Call1 and Call2 are indexes of the call in the first and the second program,
+	// Call1 is -1 for added calls and Call2 is -1 for removed calls.
+	Call1 int
+	Call2 int
+	// Name is the syscall name.
+	Name string
+	// Arg is the path to the changed arg (see argPath), Old and New are its values.
+	Arg string
+	Old string
+	New string
+}
+
+func (d DiffEntry) String() string {
+	switch d.Kind {
+	case DiffCallAdded:
+		return fmt.Sprintf("+ #%v %v", d.Call2, d.Name)
+	case DiffCallRemoved:
+		return fmt.Sprintf("- #%v %v", d.Call1, d.Name)
+	case DiffArgChanged:
+		return fmt.Sprintf("~ #%v %v %v: %v -> %v", d.Call2, d.Name, d.Arg, d.Old, d.New)
+	default:
+		return fmt.Sprintf("unknown diff %v", int(d.Kind))
+	}
+}
+
+// Diff returns structural differences between programs p1 and p2.
+// Calls are matched by syscall names (longest common subsequence), calls that
+// are not matched are reported as removed/added. For matched calls all args
+// that differ are reported. Results are compared by the calls and paths
+// of the referenced args, so inserting a call does not make all references differ.
+// The number of entries can be used as a distance between programs.
+func Diff(p1, p2 *Prog) []DiffEntry {
+	d := &differ{
+		match: matchCalls(p1, p2),
+		refs1: argRefs(p1),
+		refs2: argRefs(p2),
+	}
+	// Translate references of p1 to matched calls in p2.
+	d.refs1Matched = make(map[*Arg]string)
+	for i, c := range p1.Calls {
+		j, ok := d.match[i]
+		foreachArgPath(c, func(arg *Arg, path string) {
+			if ok {
+				d.refs1Matched[arg] = argRef(j, path)
+			} else {
+				d.refs1Matched[arg] = "removed " + argRef(i, path)
+			}
+		})
+	}
+	i, j := 0, 0
+	for i < len(p1.Calls) || j < len(p2.Calls) {
+		if j2, ok := d.match[i]; ok && j2 == j {
+			d.call1, d.call2 = i, j
+			d.name = p2.Calls[j].Meta.Name
+			c1, c2 := p1.Calls[i], p2.Calls[j]
+			if c1.Async != c2.Async {
+				d.diffs = append(d.diffs, DiffEntry{Kind: DiffArgChanged, Call1: i, Call2: j,
+					Name: d.name, Arg: "(async)", Old: fmt.Sprint(c1.Async), New: fmt.Sprint(c2.Async)})
+			}
+			for k := range c1.Args {
+				d.arg(fieldName(c1.Args[k].Type, k), c1.Args[k], c2.Args[k])
+			}
+			i++
+			j++
+			continue
+		}
+		if i < len(p1.Calls) {
+			if _, ok := d.match[i]; !ok {
+				d.diffs = append(d.diffs, DiffEntry{Kind: DiffCallRemoved, Call1: i, Call2: -1,
+					Name: p1.Calls[i].Meta.Name})
+				i++
+				continue
+			}
+		}
+		d.diffs = append(d.diffs, DiffEntry{Kind: DiffCallAdded, Call1: -1, Call2: j,
+			Name: p2.Calls[j].Meta.Name})
+		j++
+	}
+	return d.diffs
+}
+
+type differ struct {
+	match        map[int]int
+	refs1        map[*Arg]string
+	refs1Matched map[*Arg]string
+	refs2        map[*Arg]string
+	call1        int
+	call2        int
+	name         string
+	diffs        []DiffEntry
+}
+
+// matchCalls returns mapping of indexes of calls in p1 to indexes of the matching
+// calls in p2 computed as the longest common subsequence of syscall names.
+func matchCalls(p1, p2 *Prog) map[int]int {
+	n, m := len(p1.Calls), len(p2.Calls)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if p1.Calls[i].Meta == p2.Calls[j].Meta {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	match := make(map[int]int)
+	for i, j := 0, 0; i < n && j < m; {
+		switch {
+		case p1.Calls[i].Meta == p2.Calls[j].Meta:
+			match[i] = j
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return match
+}
+
+func (d *differ) changed(path string, a1, a2 *Arg) {
+	d.diffs = append(d.diffs, DiffEntry{
+		Kind:  DiffArgChanged,
+		Call1: d.call1,
+		Call2: d.call2,
+		Name:  d.name,
+		Arg:   path,
+		Old:   diffValue(a1, d.refs1),
+		New:   diffValue(a2, d.refs2),
+	})
+}
+
+func (d *differ) arg(path string, a1, a2 *Arg) {
+	if a1 == nil || a2 == nil || a1.Kind != a2.Kind {
+		if a1 != nil || a2 != nil {
+			d.changed(path, a1, a2)
+		}
+		return
+	}
+	switch a1.Kind {
+	case ArgConst:
+		if a1.Val != a2.Val {
+			d.changed(path, a1, a2)
+		}
+	case ArgResult:
+		if d.refs1Matched[a1.Res] != d.refs2[a2.Res] || a1.OpDiv != a2.OpDiv || a1.OpAdd != a2.OpAdd {
+			d.changed(path, a1, a2)
+		}
+	case ArgPointer:
+		if serializeAddr(a1, true) != serializeAddr(a2, true) {
+			d.changed(path, a1, a2)
+		}
+		d.arg(path+"*", a1.Res, a2.Res)
+	case ArgPageSize:
+		if serializeAddr(a1, false) != serializeAddr(a2, false) {
+			d.changed(path, a1, a2)
+		}
+	case ArgData:
+		if !bytes.Equal(a1.Data, a2.Data) {
+			d.changed(path, a1, a2)
+		}
+	case ArgGroup:
+		if _, ok := a1.Type.(*sys.ArrayType); ok {
+			if len(a1.Inner) != len(a2.Inner) {
+				d.changed(path, a1, a2)
+			}
+			for i := 0; i < len(a1.Inner) && i < len(a2.Inner); i++ {
+				d.arg(fmt.Sprintf("%v[%v]", path, i), a1.Inner[i], a2.Inner[i])
+			}
+		} else {
+			for i := range a1.Inner {
+				d.arg(path+"."+fieldName(a1.Inner[i].Type, i), a1.Inner[i], a2.Inner[i])
+			}
+		}
+	case ArgUnion:
+		if a1.OptionType.FieldName() != a2.OptionType.FieldName() {
+			d.changed(path, a1, a2)
+			return
+		}
+		d.arg(path+"."+fieldName(a1.OptionType, 0), a1.Option, a2.Option)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2017 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffRandom(t *testing.T) {
+	rs, iters := initTest(t)
+	for i := 0; i < iters; i++ {
+		p := Generate(rs, 10, nil)
+		if diff := Diff(p, p.Clone()); len(diff) != 0 {
+			t.Fatalf("clone differs from the original:\n%v\n%s", diff, p.Serialize())
+		}
+		p1 := p.Clone()
+		p1.Mutate(rs, 10, nil, nil)
+		Diff(p, p1)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		p1, p2 string
+		diff   []string
+	}{
+		{
+			"sched_yield()\n",
+			"sched_yield()\n",
+			nil,
+		},
+		{
+			"r0 = open(&(0x7f0000001000)=\"2e2f66696c653000\", 0x0, 0x0)\n" +
+				"read(r0, &(0x7f0000000000)=\"\", 0x1)\n",
+			"sched_yield()\n" +
+				"r0 = open(&(0x7f0000001000)=\"2e2f66696c653000\", 0x0, 0x0)\n" +
+				"read(r0, &(0x7f0000000000)=\"\", 0x2)\n",
+			[]string{
+				"+ #0 sched_yield",
+				"~ #2 read count: 0x1 -> 0x2",
+			},
+		},
+		{
+			"r0 = open(&(0x7f0000001000)=\"2e2f66696c653000\", 0x0, 0x0)\n" +
+				"r1 = open(&(0x7f0000001000)=\"2e2f66696c653000\", 0x0, 0x0)\n" +
+				"read(r0, &(0x7f0000000000)=\"\", 0x1)\n" +
+				"close(r1)\n",
+			"r0 = open(&(0x7f0000001000)=\"2e2f66696c653000\", 0x0, 0x0)\n" +
+				"r1 = open(&(0x7f0000001000)=\"2e2f66696c653100\", 0x0, 0x0)\n" +
+				"read(r1, &(0x7f0000000000)=\"\", 0x1)\n",
+			[]string{
+				"~ #1 open file*: \"2e2f66696c653000\" -> \"2e2f66696c653100\"",
+				"~ #2 read fd: #0.ret -> #1.ret",
+				"- #3 close",
+			},
+		},
+		{
+			"writev(0xffffffffffffffff, &(0x7f0000000000)=[{&(0x7f0000001000)=\"11\", 0x1}], 0x1)\n",
+			"writev(0xffffffffffffffff, &(0x7f0000000000)=[{&(0x7f0000002000)=\"11\", 0x1}, {&(0x7f0000001000)=\"22\", 0x1}], 0x2)\n",
+			[]string{
+				"~ #0 writev vec*: [1 elements] -> [2 elements]",
+				"~ #0 writev vec*[0].addr: &(0x7f0000001000) -> &(0x7f0000002000)",
+				"~ #0 writev vlen: 0x1 -> 0x2",
+			},
+		},
+	}
+	for i, test := range tests {
+		p1, err := Deserialize([]byte(test.p1))
+		if err != nil {
+			t.Fatalf("#%v: failed to deserialize: %v", i, err)
+		}
+		p2, err := Deserialize([]byte(test.p2))
+		if err != nil {
+			t.Fatalf("#%v: failed to deserialize: %v", i, err)
+		}
+		var diff []string
+		for _, d := range Diff(p1, p2) {
+			diff = append(diff, d.String())
+		}
+		if got, want := strings.Join(diff, "\n"), strings.Join(test.diff, "\n"); got != want {
+			t.Fatalf("#%v: got diff:\n%v\nwant:\n%v", i, got, want)
+		}
+	}
+}
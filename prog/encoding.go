@@ -51,7 +51,11 @@ func (p *Prog) Serialize() []byte {
 			}
 			a.serialize(buf, vars, &varSeq)
 		}
-		fmt.Fprintf(buf, ")\n")
+		fmt.Fprintf(buf, ")")
+		if c.Async {
+			fmt.Fprintf(buf, " (async)")
+		}
+		fmt.Fprintf(buf, "\n")
 	}
 	return buf.Bytes()
 }
@@ -118,8 +122,30 @@ func (a *Arg) serialize(buf io.Writer, vars map[*Arg]int, varSeq *int) {
 }
 
 func Deserialize(data []byte) (prog *Prog, err error) {
-	prog = new(Prog)
 	p := &parser{r: bufio.NewScanner(bytes.NewReader(data))}
+	return p.deserialize()
+}
+
+// DeserializeRepair is like Deserialize, but tolerates programs that don't
+// match current descriptions (e.g. after descriptions were updated).
+// Calls to unknown syscalls are dropped, missing call args and struct fields
+// are filled with default values and excessive ones are dropped,
+// args of mismatching kinds are replaced with default values,
+// references to unknown resources are replaced with default resource values
+// and stale const values are updated.
+// Returns the repaired program and a description of every change made.
+// The list is empty if the program matches descriptions.
+func DeserializeRepair(data []byte) (prog *Prog, fixes []string, err error) {
+	p := &parser{r: bufio.NewScanner(bytes.NewReader(data)), repair: true}
+	prog, err = p.deserialize()
+	if err != nil {
+		return nil, nil, err
+	}
+	return prog, p.fixes, nil
+}
+
+func (p *parser) deserialize() (prog *Prog, err error) {
+	prog = new(Prog)
 	p.r.Buffer(nil, maxLineLen)
 	vars := make(map[string]*Arg)
 	for p.Scan() {
@@ -136,6 +162,10 @@ func Deserialize(data []byte) (prog *Prog, err error) {
 		}
 		meta := sys.CallMap[name]
 		if meta == nil {
+			if p.repair && p.Err() == nil {
+				p.fixf("dropped call to unknown syscall %v", name)
+				continue
+			}
 			return nil, fmt.Errorf("unknown syscall %v", name)
 		}
 		c := &Call{
@@ -143,9 +173,18 @@ func Deserialize(data []byte) (prog *Prog, err error) {
 			Ret:  returnArg(meta.Ret),
 		}
 		prog.Calls = append(prog.Calls, c)
+		nfixes := len(p.fixes)
 		p.Parse('(')
 		for i := 0; p.Char() != ')'; i++ {
 			if i >= len(meta.Args) {
+				if p.repair && p.Err() == nil {
+					p.fixf("%v: dropped excessive arg #%v", name, i)
+					p.skipArg()
+					if p.Char() != ')' {
+						p.Parse(',')
+					}
+					continue
+				}
 				return nil, fmt.Errorf("wrong call arg count: %v, want %v", i+1, len(meta.Args))
 			}
 			typ := meta.Args[i]
@@ -156,15 +195,37 @@ func Deserialize(data []byte) (prog *Prog, err error) {
 			if err != nil {
 				return nil, err
 			}
-			c.Args = append(c.Args, arg)
+			c.Args = append(c.Args, p.repairNil(typ, arg))
 			if p.Char() != ')' {
 				p.Parse(',')
 			}
 		}
 		p.Parse(')')
+		if !p.EOF() && p.Char() == '(' {
+			p.Parse('(')
+			switch attr := p.Ident(); attr {
+			case "async":
+				c.Async = true
+			default:
+				if !p.repair {
+					return nil, fmt.Errorf("unknown call attribute %v (line #%v)", attr, p.l)
+				}
+				p.fixf("%v: dropped unknown call attribute %v", name, attr)
+			}
+			p.Parse(')')
+		}
 		if !p.EOF() {
 			return nil, fmt.Errorf("tailing data (line #%v)", p.l)
 		}
+		if p.repair {
+			for i := len(c.Args); i < len(meta.Args); i++ {
+				p.fixf("%v: added missing arg %v", name, meta.Args[i].Name())
+				c.Args = append(c.Args, defaultArg(meta.Args[i]))
+			}
+			if len(p.fixes) != nfixes {
+				assignSizesCall(c)
+			}
+		}
 		if len(c.Args) != len(meta.Args) {
 			return nil, fmt.Errorf("wrong call arg count: %v, want %v", len(c.Args), len(meta.Args))
 		}
@@ -192,6 +253,16 @@ func parseArg(typ sys.Type, p *parser, vars map[string]*Arg) (*Arg, error) {
 		p.Parse('=')
 		p.Parse('>')
 	}
+	if p.repair && p.Err() == nil && !argFits(typ, p.Char()) {
+		if typ == nil {
+			p.fixf("dropped arg '%c' that should be nil", p.Char())
+			p.skipArg()
+			return nil, nil
+		}
+		p.fixf("replaced arg '%c' of mismatching kind with default %v", p.Char(), typ.Name())
+		p.skipArg()
+		return defaultArg(typ), nil
+	}
 	var arg *Arg
 	switch p.Char() {
 	case '0':
@@ -203,11 +274,7 @@ func parseArg(typ sys.Type, p *parser, vars map[string]*Arg) (*Arg, error) {
 		arg = constArg(typ, uintptr(v))
 	case 'r':
 		id := p.Ident()
-		v, ok := vars[id]
-		if !ok || v == nil {
-			return nil, fmt.Errorf("result %v references unknown variable (vars=%+v)", id, vars)
-		}
-		arg = resultArg(typ, v)
+		var opDiv, opAdd uintptr
 		if p.Char() == '/' {
 			p.Parse('/')
 			op := p.Ident()
@@ -215,7 +282,7 @@ func parseArg(typ sys.Type, p *parser, vars map[string]*Arg) (*Arg, error) {
 			if err != nil {
 				return nil, fmt.Errorf("wrong result div op: '%v'", op)
 			}
-			arg.OpDiv = uintptr(v)
+			opDiv = uintptr(v)
 		}
 		if p.Char() == '+' {
 			p.Parse('+')
@@ -224,8 +291,20 @@ func parseArg(typ sys.Type, p *parser, vars map[string]*Arg) (*Arg, error) {
 			if err != nil {
 				return nil, fmt.Errorf("wrong result add op: '%v'", op)
 			}
-			arg.OpAdd = uintptr(v)
+			opAdd = uintptr(v)
 		}
+		v, ok := vars[id]
+		if !ok || v == nil {
+			if !p.repair {
+				return nil, fmt.Errorf("result %v references unknown variable (vars=%+v)", id, vars)
+			}
+			p.fixf("replaced reference to unknown result %v with default %v", id, typ.Name())
+			arg = constArg(typ, typ.Default())
+			break
+		}
+		arg = resultArg(typ, v)
+		arg.OpDiv = opDiv
+		arg.OpAdd = opAdd
 	case '&':
 		var typ1 sys.Type
 		switch t1 := typ.(type) {
@@ -273,6 +352,14 @@ func parseArg(typ sys.Type, p *parser, vars map[string]*Arg) (*Arg, error) {
 		var inner []*Arg
 		for i := 0; p.Char() != '}'; i++ {
 			if i >= len(t1.Fields) {
+				if p.repair && p.Err() == nil {
+					p.fixf("struct %v: dropped excessive field #%v", typ.Name(), i)
+					p.skipArg()
+					if p.Char() != '}' {
+						p.Parse(',')
+					}
+					continue
+				}
 				return nil, fmt.Errorf("wrong struct arg count: %v, want %v", i+1, len(t1.Fields))
 			}
 			fld := t1.Fields[i]
@@ -283,14 +370,22 @@ func parseArg(typ sys.Type, p *parser, vars map[string]*Arg) (*Arg, error) {
 				if err != nil {
 					return nil, err
 				}
-				inner = append(inner, arg)
+				inner = append(inner, p.repairNil(fld, arg))
 				if p.Char() != '}' {
 					p.Parse(',')
 				}
 			}
 		}
 		p.Parse('}')
-		if last := t1.Fields[len(t1.Fields)-1]; sys.IsPad(last) {
+		if p.repair {
+			for i := len(inner); i < len(t1.Fields); i++ {
+				fld := t1.Fields[i]
+				if !sys.IsPad(fld) {
+					p.fixf("struct %v: added missing field %v", typ.Name(), fld.FieldName())
+				}
+				inner = append(inner, defaultArg(fld))
+			}
+		} else if last := t1.Fields[len(t1.Fields)-1]; sys.IsPad(last) {
 			inner = append(inner, constArg(last, 0))
 		}
 		arg = groupArg(typ, inner)
@@ -306,7 +401,7 @@ func parseArg(typ sys.Type, p *parser, vars map[string]*Arg) (*Arg, error) {
 			if err != nil {
 				return nil, err
 			}
-			inner = append(inner, arg)
+			inner = append(inner, p.repairNil(t1.Type, arg))
 			if p.Char() != ']' {
 				p.Parse(',')
 			}
@@ -329,13 +424,19 @@ func parseArg(typ sys.Type, p *parser, vars map[string]*Arg) (*Arg, error) {
 			}
 		}
 		if optType == nil {
-			return nil, fmt.Errorf("union arg %v has unknown option: %v", typ.Name(), name)
+			if !p.repair {
+				return nil, fmt.Errorf("union arg %v has unknown option: %v", typ.Name(), name)
+			}
+			p.fixf("union %v: replaced unknown option %v with default", typ.Name(), name)
+			p.skipArg()
+			arg = defaultArg(typ)
+			break
 		}
 		opt, err := parseArg(optType, p, vars)
 		if err != nil {
 			return nil, err
 		}
-		arg = unionArg(typ, opt, optType)
+		arg = unionArg(typ, p.repairNil(optType, opt), optType)
 	case 'n':
 		p.Parse('n')
 		p.Parse('i')
@@ -346,6 +447,9 @@ func parseArg(typ sys.Type, p *parser, vars map[string]*Arg) (*Arg, error) {
 	default:
 		return nil, fmt.Errorf("failed to parse argument at %v (line #%v/%v: %v)", int(p.Char()), p.l, p.i, p.s)
 	}
+	if p.repair && arg != nil {
+		p.repairArg(arg)
+	}
 	if r != "" {
 		vars[r] = arg
 	}
@@ -437,6 +541,9 @@ type parser struct {
 	i int
 	l int
 	e error
+
+	repair bool     // repair the program instead of failing, see DeserializeRepair
+	fixes  []string // changes made in repair mode
 }
 
 func (p *parser) Scan() bool {
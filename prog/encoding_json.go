@@ -0,0 +1,353 @@
+// Copyright 2017 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/google/syzkaller/sys"
+)
+
+// JSON representation of programs. Unlike the text format it is self-describing
+// (every argument carries its kind, type name, field name and direction),
+// so external tools can consume programs without reimplementing the parser.
+// The representation is lossless: DeserializeJSON(p.SerializeJSON())
+// produces a program identical to p.
+//
+// Integer values are encoded as hex strings to not lose precision in
+// JSON parsers that represent numbers as float64.
+
+type jsonProg struct {
+	Calls []*jsonCall `json:"calls"`
+}
+
+type jsonCall struct {
+	Name  string     `json:"name"`
+	Var   string     `json:"var,omitempty"` // variable name for the return value, if referenced
+	Args  []*jsonArg `json:"args"`
+	Async bool       `json:"async,omitempty"`
+}
+
+type jsonArg struct {
+	Kind  string `json:"kind"`
+	Type  string `json:"type"`
+	Field string `json:"field,omitempty"`
+	Dir   string `json:"dir"`
+	Var   string `json:"var,omitempty"` // variable name for this arg, if referenced
+
+	Val   string `json:"val,omitempty"`    // const
+	Ref   string `json:"ref,omitempty"`    // result
+	OpDiv string `json:"op_div,omitempty"` // result
+	OpAdd string `json:"op_add,omitempty"` // result
+
+	Page   uint64 `json:"page,omitempty"`   // pointer, pagesize
+	Offset int    `json:"offset,omitempty"` // pointer, pagesize
+	Pages  uint64 `json:"pages,omitempty"`  // pointer
+
+	Data string `json:"data,omitempty"` // data (hex)
+
+	Inner  []*jsonArg `json:"inner,omitempty"`  // group
+	Option string     `json:"option,omitempty"` // union
+	Value  *jsonArg   `json:"value,omitempty"`  // pointer, union
+}
+
+var argKindNames = map[ArgKind]string{
+	ArgConst:    "const",
+	ArgResult:   "result",
+	ArgPointer:  "pointer",
+	ArgPageSize: "pagesize",
+	ArgData:     "data",
+	ArgGroup:    "group",
+	ArgUnion:    "union",
+}
+
+var dirNames = map[sys.Dir]string{
+	sys.DirIn:    "in",
+	sys.DirOut:   "out",
+	sys.DirInOut: "inout",
+}
+
+// SerializeJSON returns JSON representation of the program.
+func (p *Prog) SerializeJSON() []byte {
+	if debug {
+		if err := p.validate(); err != nil {
+			panic("serializing invalid program")
+		}
+	}
+	vars := make(map[*Arg]string)
+	jp := &jsonProg{Calls: []*jsonCall{}}
+	for _, c := range p.Calls {
+		jc := &jsonCall{
+			Name:  c.Meta.Name,
+			Args:  []*jsonArg{},
+			Async: c.Async,
+		}
+		if len(c.Ret.Uses) != 0 {
+			jc.Var = fmt.Sprintf("r%v", len(vars))
+			vars[c.Ret] = jc.Var
+		}
+		for _, a := range c.Args {
+			jc.Args = append(jc.Args, a.toJSON(vars))
+		}
+		jp.Calls = append(jp.Calls, jc)
+	}
+	data, err := json.MarshalIndent(jp, "", "\t")
+	if err != nil {
+		panic(fmt.Sprintf("failed to marshal program: %v", err))
+	}
+	return data
+}
+
+func (a *Arg) toJSON(vars map[*Arg]string) *jsonArg {
+	if a == nil {
+		return nil
+	}
+	kind, ok := argKindNames[a.Kind]
+	if !ok {
+		panic(fmt.Sprintf("unknown arg kind %v", a.Kind))
+	}
+	ja := &jsonArg{
+		Kind:  kind,
+		Type:  a.Type.Name(),
+		Field: a.Type.FieldName(),
+		Dir:   dirNames[a.Type.Dir()],
+	}
+	if len(a.Uses) != 0 {
+		ja.Var = fmt.Sprintf("r%v", len(vars))
+		vars[a] = ja.Var
+	}
+	switch a.Kind {
+	case ArgConst:
+		ja.Val = jsonHex(a.Val)
+	case ArgResult:
+		ref, ok := vars[a.Res]
+		if !ok {
+			panic("no result")
+		}
+		ja.Ref = ref
+		if a.OpDiv != 0 {
+			ja.OpDiv = jsonHex(a.OpDiv)
+		}
+		if a.OpAdd != 0 {
+			ja.OpAdd = jsonHex(a.OpAdd)
+		}
+	case ArgPointer:
+		ja.Page = uint64(a.AddrPage)
+		ja.Offset = a.AddrOffset
+		ja.Pages = uint64(a.AddrPagesNum)
+		ja.Value = a.Res.toJSON(vars)
+	case ArgPageSize:
+		ja.Page = uint64(a.AddrPage)
+		ja.Offset = a.AddrOffset
+	case ArgData:
+		ja.Data = hex.EncodeToString(a.Data)
+	case ArgGroup:
+		ja.Inner = []*jsonArg{}
+		for _, a1 := range a.Inner {
+			ja.Inner = append(ja.Inner, a1.toJSON(vars))
+		}
+	case ArgUnion:
+		ja.Option = a.OptionType.FieldName()
+		ja.Value = a.Option.toJSON(vars)
+	}
+	return ja
+}
+
+func jsonHex(v uintptr) string {
+	return fmt.Sprintf("0x%x", v)
+}
+
+// DeserializeJSON parses a program produced by SerializeJSON.
+// Every argument is checked against the syscall descriptions
+// and the resulting program is validated.
+func DeserializeJSON(data []byte) (*Prog, error) {
+	jp := new(jsonProg)
+	if err := json.Unmarshal(data, jp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal program: %v", err)
+	}
+	p := new(Prog)
+	vars := make(map[string]*Arg)
+	for i, jc := range jp.Calls {
+		if jc == nil {
+			return nil, fmt.Errorf("call #%v is null", i)
+		}
+		meta := sys.CallMap[jc.Name]
+		if meta == nil {
+			return nil, fmt.Errorf("unknown syscall %v", jc.Name)
+		}
+		if len(jc.Args) != len(meta.Args) {
+			return nil, fmt.Errorf("call %v: wrong call arg count: %v, want %v",
+				jc.Name, len(jc.Args), len(meta.Args))
+		}
+		c := &Call{
+			Meta:  meta,
+			Ret:   returnArg(meta.Ret),
+			Async: jc.Async,
+		}
+		for j, ja := range jc.Args {
+			arg, err := argFromJSON(meta.Args[j], ja, vars)
+			if err != nil {
+				return nil, fmt.Errorf("call %v: arg #%v: %v", jc.Name, j, err)
+			}
+			c.Args = append(c.Args, arg)
+		}
+		if jc.Var != "" {
+			if err := defineJSONVar(vars, jc.Var, c.Ret); err != nil {
+				return nil, fmt.Errorf("call %v: %v", jc.Name, err)
+			}
+		}
+		p.Calls = append(p.Calls, c)
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func argFromJSON(typ sys.Type, ja *jsonArg, vars map[string]*Arg) (*Arg, error) {
+	if ja == nil {
+		return nil, nil
+	}
+	if ja.Type != typ.Name() || ja.Field != typ.FieldName() {
+		return nil, fmt.Errorf("type %v/%v does not match description %v/%v",
+			ja.Type, ja.Field, typ.Name(), typ.FieldName())
+	}
+	if ja.Dir != dirNames[typ.Dir()] {
+		return nil, fmt.Errorf("arg %v has direction %v, want %v", ja.Field, ja.Dir, dirNames[typ.Dir()])
+	}
+	var arg *Arg
+	switch ja.Kind {
+	case "const":
+		v, err := parseJSONHex(ja.Val)
+		if err != nil {
+			return nil, err
+		}
+		arg = constArg(typ, v)
+	case "result":
+		res, ok := vars[ja.Ref]
+		if !ok {
+			return nil, fmt.Errorf("result references unknown variable %q", ja.Ref)
+		}
+		arg = resultArg(typ, res)
+		var err error
+		if ja.OpDiv != "" {
+			if arg.OpDiv, err = parseJSONHex(ja.OpDiv); err != nil {
+				return nil, err
+			}
+		}
+		if ja.OpAdd != "" {
+			if arg.OpAdd, err = parseJSONHex(ja.OpAdd); err != nil {
+				return nil, err
+			}
+		}
+	case "pointer":
+		var typ1 sys.Type
+		switch t1 := typ.(type) {
+		case *sys.PtrType:
+			typ1 = t1.Type
+		case *sys.VmaType:
+			if ja.Value != nil {
+				return nil, fmt.Errorf("vma arg %v has a value", ja.Field)
+			}
+		default:
+			return nil, fmt.Errorf("pointer arg %v is not a pointer: %v", ja.Field, typ.Name())
+		}
+		var inner *Arg
+		if typ1 != nil {
+			var err error
+			if inner, err = argFromJSON(typ1, ja.Value, vars); err != nil {
+				return nil, err
+			}
+		}
+		arg = pointerArg(typ, uintptr(ja.Page), ja.Offset, uintptr(ja.Pages), inner)
+	case "pagesize":
+		arg = pageSizeArg(typ, uintptr(ja.Page), ja.Offset)
+	case "data":
+		if _, ok := typ.(*sys.BufferType); !ok {
+			return nil, fmt.Errorf("data arg %v is not a buffer: %v", ja.Field, typ.Name())
+		}
+		data, err := hex.DecodeString(ja.Data)
+		if err != nil {
+			return nil, fmt.Errorf("data arg %v has bad value %q", ja.Field, ja.Data)
+		}
+		arg = dataArg(typ, data)
+	case "group":
+		var inner []*Arg
+		switch t1 := typ.(type) {
+		case *sys.StructType:
+			if len(ja.Inner) != len(t1.Fields) {
+				return nil, fmt.Errorf("wrong struct %v field count: %v, want %v",
+					typ.Name(), len(ja.Inner), len(t1.Fields))
+			}
+			for i, ja1 := range ja.Inner {
+				arg1, err := argFromJSON(t1.Fields[i], ja1, vars)
+				if err != nil {
+					return nil, err
+				}
+				inner = append(inner, arg1)
+			}
+		case *sys.ArrayType:
+			for _, ja1 := range ja.Inner {
+				arg1, err := argFromJSON(t1.Type, ja1, vars)
+				if err != nil {
+					return nil, err
+				}
+				inner = append(inner, arg1)
+			}
+		default:
+			return nil, fmt.Errorf("group arg %v is not a struct or array: %v", ja.Field, typ.Name())
+		}
+		arg = groupArg(typ, inner)
+	case "union":
+		t1, ok := typ.(*sys.UnionType)
+		if !ok {
+			return nil, fmt.Errorf("union arg %v is not a union: %v", ja.Field, typ.Name())
+		}
+		var optType sys.Type
+		for _, t2 := range t1.Options {
+			if ja.Option == t2.FieldName() {
+				optType = t2
+				break
+			}
+		}
+		if optType == nil {
+			return nil, fmt.Errorf("union arg %v has unknown option: %v", typ.Name(), ja.Option)
+		}
+		opt, err := argFromJSON(optType, ja.Value, vars)
+		if err != nil {
+			return nil, err
+		}
+		arg = unionArg(typ, opt, optType)
+	default:
+		return nil, fmt.Errorf("arg %v has unknown kind %q", ja.Field, ja.Kind)
+	}
+	if ja.Var != "" {
+		if err := defineJSONVar(vars, ja.Var, arg); err != nil {
+			return nil, err
+		}
+	}
+	return arg, nil
+}
+
+func defineJSONVar(vars map[string]*Arg, name string, arg *Arg) error {
+	if _, ok := vars[name]; ok {
+		return fmt.Errorf("variable %q is defined twice", name)
+	}
+	vars[name] = arg
+	return nil
+}
+
+func parseJSONHex(s string) (uintptr, error) {
+	if s == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseUint(s, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad value %q: %v", s, err)
+	}
+	return uintptr(v), nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2017 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSerializeJSONRandom(t *testing.T) {
+	rs, iters := initTest(t)
+	for i := 0; i < iters; i++ {
+		p := Generate(rs, 10, nil)
+		data := p.SerializeJSON()
+		p1, err := DeserializeJSON(data)
+		if err != nil {
+			t.Fatalf("failed to deserialize JSON: %v\nprogram:\n%s\njson:\n%s", err, p.Serialize(), data)
+		}
+		if text, text1 := p.Serialize(), p1.Serialize(); !bytes.Equal(text, text1) {
+			t.Fatalf("program changed after JSON round-trip\noriginal:\n%s\n\nnew:\n%s\n", text, text1)
+		}
+		if data1 := p1.SerializeJSON(); !bytes.Equal(data, data1) {
+			t.Fatalf("JSON changed after round-trip\noriginal:\n%s\n\nnew:\n%s\n", data, data1)
+		}
+	}
+}
+
+func TestDeserializeJSON(t *testing.T) {
+	tests := []struct {
+		data string
+		err  string
+	}{
+		{
+			`{"calls": [{"name": "foobar", "args": []}]}`,
+			"unknown syscall foobar",
+		},
+		{
+			`{"calls": [{"name": "getpid", "args": [{"kind": "const", "type": "intptr", "dir": "in"}]}]}`,
+			"wrong call arg count",
+		},
+		{
+			`{"calls": [{"name": "close", "args": [{"kind": "const", "type": "intptr", "field": "fd", "dir": "in"}]}]}`,
+			"does not match description",
+		},
+		{
+			`{"calls": [{"name": "close", "args": [{"kind": "result", "type": "fd", "field": "fd", "dir": "in", "ref": "r0"}]}]}`,
+			"unknown variable",
+		},
+		{
+			`{"calls": [{"name": "close", "args": [{"kind": "const", "type": "fd", "field": "fd", "dir": "in", "val": "foo"}]}]}`,
+			"bad value",
+		},
+		{
+			`{"calls": [{"name": "close", "args": [{"kind": "const", "type": "fd", "field": "fd", "dir": "in", "val": "0x3"}]}]}`,
+			"",
+		},
+	}
+	for i, test := range tests {
+		_, err := DeserializeJSON([]byte(test.data))
+		if test.err == "" {
+			if err != nil {
+				t.Fatalf("#%v: failed to deserialize: %v", i, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Fatalf("#%v: got error %v, want %q", i, err, test.err)
+		}
+	}
+}
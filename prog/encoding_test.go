@@ -93,3 +93,21 @@ func TestCallSetRandom(t *testing.T) {
 		}
 	}
 }
+
+func TestSerializeAsync(t *testing.T) {
+	data := "r0 = open(&(0x7f0000001000)=\"2e2f66696c653000\", 0x0, 0x0) (async)\n" +
+		"read(r0, &(0x7f0000000000)=\"\", 0x1)\n"
+	p, err := Deserialize([]byte(data))
+	if err != nil {
+		t.Fatalf("failed to deserialize: %v", err)
+	}
+	if !p.Calls[0].Async || p.Calls[1].Async {
+		t.Fatalf("wrong async attributes: %v, %v", p.Calls[0].Async, p.Calls[1].Async)
+	}
+	if data1 := p.Clone().Serialize(); string(data1) != data {
+		t.Fatalf("program changed after serialization\noriginal:\n%s\n\nnew:\n%s\n", data, data1)
+	}
+	if _, err := Deserialize([]byte("getpid() (foo)\n")); err == nil {
+		t.Fatalf("unknown call attribute is not rejected")
+	}
+}
@@ -17,6 +17,7 @@ const (
 	ExecInstrEOF = ^uintptr(iota)
 	ExecInstrCopyin
 	ExecInstrCopyout
+	ExecInstrAsync // the next call is async (see Call.Async)
 )
 
 const (
@@ -157,6 +158,10 @@ func (p *Prog) SerializeForExec(buffer []byte, pid int) error {
 			}
 		}
 		// Generate the call itself.
+		if c.Async {
+			w.write(ExecInstrAsync)
+			instrSeq++
+		}
 		w.write(uintptr(c.Meta.ID))
 		w.write(uintptr(len(c.Args)))
 		for _, arg := range c.Args {
@@ -33,13 +33,15 @@ func TestSerializeForExec(t *testing.T) {
 	//  - ExecArgConst: value is const value
 	//  - ExecArgResult: value is index of a call whose result we want to reference
 	//  - ExecArgData: value is a binary blob (represented as ]size/8[ uint64's)
-	// There are 2 other special call:
+	// There are 3 other special calls:
 	//  - ExecInstrCopyin: copies its second argument into address specified by first argument
 	//  - ExecInstrCopyout: reads value at address specified by first argument (result can be referenced by ExecArgResult)
+	//  - ExecInstrAsync: the next call is executed asynchronously
 	const (
 		instrEOF     = uint64(ExecInstrEOF)
 		instrCopyin  = uint64(ExecInstrCopyin)
 		instrCopyout = uint64(ExecInstrCopyout)
+		instrAsync   = uint64(ExecInstrAsync)
 		argConst     = uint64(ExecArgConst)
 		argResult    = uint64(ExecArgResult)
 		argData      = uint64(ExecArgData)
@@ -62,6 +64,14 @@ func TestSerializeForExec(t *testing.T) {
 				instrEOF,
 			},
 		},
+		{
+			"syz_test() (async)\nsyz_test()",
+			[]uint64{
+				instrAsync, callID("syz_test"), 0,
+				callID("syz_test"), 0,
+				instrEOF,
+			},
+		},
 		{
 			"syz_test$int(0x1, 0x2, 0x3, 0x4, 0x5)",
 			[]uint64{
@@ -10,6 +10,10 @@ import (
 // Generate generates a random program of length ~ncalls.
 // calls is a set of allowed syscalls, if nil all syscalls are used.
 func Generate(rs rand.Source, ncalls int, ct *ChoiceTable) *Prog {
+	return generate(rs, ncalls, ct, nil)
+}
+
+func generate(rs rand.Source, ncalls int, ct *ChoiceTable, trace *MutationTrace) *Prog {
 	p := new(Prog)
 	r := newRand(rs)
 	s := newState(ct)
@@ -19,6 +23,11 @@ func Generate(rs rand.Source, ncalls int, ct *ChoiceTable) *Prog {
 			s.analyze(c)
 			p.Calls = append(p.Calls, c)
 		}
+		if trace != nil {
+			trace.add(Mutation{Kind: MutationInsertCall, Call: len(p.Calls) - 1,
+				Name: calls[len(calls)-1].Meta.Name, Ncalls: len(calls),
+				Text: callsText(p, len(p.Calls)-len(calls), len(p.Calls))})
+		}
 	}
 	if debug {
 		if err := p.validate(); err != nil {
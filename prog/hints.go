@@ -0,0 +1,257 @@
+// Copyright 2017 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+// A hint is basically a tuple consisting of a pointer to an argument
+// in one of the syscalls of a program and a value, which should be
+// assigned to that argument (we call it a replacer).
+//
+// A simplified version of hints workflow looks like this:
+// 1. Fuzzer launches a program (we call it a hint seed) and collects all
+//    the comparisons' data for every syscall in the program.
+// 2. Next it tries to match the obtained comparison operands' values
+//    vs. the input arguments' values.
+// 3. For every such match the fuzzer mutates the program by
+//    replacing the pointed argument with the saved value.
+// 4. If a valid program is obtained, then fuzzer launches it and
+//    checks if new coverage is obtained.
+// For more insights on particular mutations please see prog/hints_test.go.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/google/syzkaller/sys"
+)
+
+type uint64Set map[uint64]bool
+
+// CompMap maps comparison operands that could come from the input
+// to the operands they were compared with.
+// Example: for comparisons {(op1, op2), (op1, op3), (op1, op4), (op2, op1)}
+// this map will store {op1: {op2, op3, op4}, op2: {op1}}.
+type CompMap map[uint64]uint64Set
+
+const (
+	// Only that many first bytes of data args are checked for matches,
+	// otherwise large buffers produce an unreasonable number of candidates.
+	maxDataLength = 100
+)
+
+var specialIntsSet uint64Set
+
+func init() {
+	specialIntsSet = make(uint64Set)
+	for _, v := range specialInts {
+		specialIntsSet[uint64(v)] = true
+	}
+}
+
+func (m CompMap) AddComp(arg1, arg2 uint64) {
+	if _, ok := m[arg1]; !ok {
+		m[arg1] = make(uint64Set)
+	}
+	m[arg1][arg2] = true
+}
+
+func (m CompMap) String() string {
+	var keys []uint64
+	for v := range m {
+		keys = append(keys, v)
+	}
+	sort.Sort(uint64Array(keys))
+	buf := new(bytes.Buffer)
+	for _, v := range keys {
+		if buf.Len() != 0 {
+			fmt.Fprintf(buf, ", ")
+		}
+		fmt.Fprintf(buf, "0x%x:", v)
+		var comps []uint64
+		for c := range m[v] {
+			comps = append(comps, c)
+		}
+		sort.Sort(uint64Array(comps))
+		for _, c := range comps {
+			fmt.Fprintf(buf, " 0x%x", c)
+		}
+	}
+	return buf.String()
+}
+
+// MutateWithHints mutates call callIndex of program p using comparison operands
+// collected for this call and invokes exec for each of the resulting programs.
+// p itself is not modified.
+func (p *Prog) MutateWithHints(callIndex int, comps CompMap, exec func(p *Prog)) {
+	if len(comps) == 0 {
+		return
+	}
+	p = p.Clone()
+	c := p.Calls[callIndex]
+	execValidate := func() {
+		// sanitizeCall can change args other than the hinted one,
+		// so it's applied to a copy to not affect subsequent candidates.
+		p1 := p.Clone()
+		sanitizeCall(p1.Calls[callIndex])
+		if debug {
+			if err := p1.validate(); err != nil {
+				panic(fmt.Sprintf("invalid hints candidate: %v", err))
+			}
+		}
+		exec(p1)
+	}
+	foreachArg(c, func(arg, _ *Arg, _ *[]*Arg) {
+		generateHints(comps, arg, execValidate)
+	})
+}
+
+func generateHints(comps CompMap, arg *Arg, exec func()) {
+	if arg.Type.Dir() == sys.DirOut {
+		return
+	}
+	switch typ := arg.Type.(type) {
+	case *sys.IntType, *sys.FlagsType, *sys.LenType, *sys.ResourceType:
+		if arg.Kind == ArgConst {
+			checkConstArg(arg, comps, exec)
+		}
+	case *sys.BufferType:
+		switch typ.Kind {
+		case sys.BufferBlobRand, sys.BufferBlobRange, sys.BufferString:
+			if arg.Kind == ArgData {
+				checkDataArg(arg, comps, exec)
+			}
+		case sys.BufferFilename:
+			// This can generate escaping paths and is probably not too useful anyway.
+		}
+	case *sys.ConstType, *sys.ProcType, *sys.CsumType:
+		// Consts are fixed by descriptions, procs will not pass validation
+		// and checksums are always computed.
+	}
+}
+
+func checkConstArg(arg *Arg, comps CompMap, exec func()) {
+	original := arg.Val
+	for _, replacer := range shrinkExpand(uint64(original), comps) {
+		arg.Val = uintptr(replacer)
+		exec()
+	}
+	arg.Val = original
+}
+
+func checkDataArg(arg *Arg, comps CompMap, exec func()) {
+	size := len(arg.Data)
+	if size > maxDataLength {
+		size = maxDataLength
+	}
+	var original, replacement [8]byte
+	for i := 0; i < size; i++ {
+		n := copy(original[:], arg.Data[i:])
+		for j := n; j < len(original); j++ {
+			original[j] = 0
+		}
+		val := binary.LittleEndian.Uint64(original[:])
+		for _, replacer := range shrinkExpand(val, comps) {
+			binary.LittleEndian.PutUint64(replacement[:], replacer)
+			copy(arg.Data[i:], replacement[:])
+			exec()
+		}
+		copy(arg.Data[i:], original[:n])
+	}
+}
+
+// shrinkExpand returns values that should replace v given the observed comparisons.
+// Shrink and expand mutations model the cases when the syscall arguments
+// are casted to narrower (and wider) integer types.
+//
+// Motivation for shrink: consider f(u16 x) that does u8 y = (u8)x and then
+// checks y == 0xab. If we call f(0x1234), then we'll see a comparison
+// 0x34 vs 0xab and we'll be unable to match the argument 0x1234 with any of
+// the comparison operands. Thus we shrink 0x1234 to 0x34 and try to match 0x34.
+// If there's a match for the shrank value, then we replace the corresponding
+// bytes of the input (in the given example we'll get 0x12ab).
+// If the other comparison operand is wider than the shrank value
+// (e.g. y == 0xdeadbeef), the comparison is ignored.
+//
+// Motivation for expand: consider f(i8 x) that does i16 y = (i16)x and then
+// checks y == -2. Suppose we call f(-1), then we'll see a comparison
+// 0xffff vs 0xfffe and be unable to match input vs any operands.
+// Thus we sign extend the input and check the extension. Note that executor sign extends all the comparison
+// operands to 64 bits.
+//
+// Both little- and big-endian representations of v are matched,
+// because kernel code frequently converts constants rather than data
+// (e.g. pkt->proto == htons(ETH_P_IP)).
+func shrinkExpand(v uint64, comps CompMap) []uint64 {
+	replacers := make(uint64Set)
+	for _, iwidth := range []int{8, 4, 2, 1, -4, -2, -1} {
+		width := iwidth
+		if width < 0 {
+			width = -width
+		}
+		size := uint(width) * 8
+		mask := ^uint64(0)
+		if size < 64 {
+			mask = 1<<size - 1
+		}
+		mutant := v & mask
+		if iwidth < 0 {
+			mutant = v | ^mask
+		}
+		for _, bigEndian := range []bool{false, true} {
+			m := mutant
+			if bigEndian {
+				if width == 1 {
+					continue
+				}
+				m = swapWidth(mutant&mask, width) | mutant&^mask
+			}
+			for newV := range comps[m] {
+				if newHi := newV &^ mask; newHi != 0 && newHi != ^mask {
+					// The other operand is wider than the shrank value.
+					continue
+				}
+				newV &= mask
+				if bigEndian {
+					newV = swapWidth(newV, width)
+				}
+				if specialIntsSet[newV] {
+					// Don't waste time on values that random mutation generates anyway.
+					continue
+				}
+				// Replace size least significant bits of v with corresponding bits of newV.
+				replacer := v&^mask | newV
+				if replacer == v {
+					continue
+				}
+				replacers[replacer] = true
+			}
+		}
+	}
+	res := make([]uint64, 0, len(replacers))
+	for r := range replacers {
+		res = append(res, r)
+	}
+	sort.Sort(uint64Array(res))
+	return res
+}
+
+func swapWidth(v uint64, width int) uint64 {
+	switch width {
+	case 2:
+		return uint64(swap16(uint16(v)))
+	case 4:
+		return uint64(swap32(uint32(v)))
+	case 8:
+		return swap64(v)
+	default:
+		panic(fmt.Sprintf("bad width %v", width))
+	}
+}
+
+type uint64Array []uint64
+
+func (a uint64Array) Len() int           { return len(a) }
+func (a uint64Array) Less(i, j int) bool { return a[i] < a[j] }
+func (a uint64Array) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
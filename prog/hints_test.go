@@ -0,0 +1,157 @@
+// Copyright 2017 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/syzkaller/sys"
+)
+
+func TestHintsShrinkExpand(t *testing.T) {
+	tests := []struct {
+		in    uint64
+		comps CompMap
+		res   []uint64
+	}{
+		// Exact 64-bit match.
+		{
+			0x1234567890abcdef,
+			CompMap{0x1234567890abcdef: uint64Set{0xfeedfacedeadbeef: true}},
+			[]uint64{0xfeedfacedeadbeef},
+		},
+		// Shrink to 8 bits: only the least significant byte is replaced.
+		{
+			0x1234,
+			CompMap{0x34: uint64Set{0xab: true}},
+			[]uint64{0x12ab},
+		},
+		// Shrink with an operand that does not fit into the shrank width.
+		{
+			0x1234,
+			CompMap{0x34: uint64Set{0xdeadbeef: true}},
+			[]uint64{},
+		},
+		// Expand: i8 -1 compared as i16 -1 vs -2.
+		{
+			0xff,
+			CompMap{0xffffffffffffffff: uint64Set{0xfffffffffffffffe: true}},
+			[]uint64{0xfe},
+		},
+		// Big-endian 16-bit match.
+		{
+			0x0008,
+			CompMap{0x0800: uint64Set{0x86dd: true}},
+			[]uint64{0xdd86},
+		},
+		// Special ints and values equal to the input are skipped.
+		{
+			0x1234,
+			CompMap{0x1234: uint64Set{0x0: true, 0x1234: true, 0x4321: true}},
+			[]uint64{0x4321},
+		},
+		// No matches.
+		{
+			0x1234,
+			CompMap{0x5678: uint64Set{0x4321: true}},
+			[]uint64{},
+		},
+	}
+	for i, test := range tests {
+		res := shrinkExpand(test.in, test.comps)
+		if !reflect.DeepEqual(res, test.res) {
+			t.Errorf("test #%v: in=0x%x comps=%v\ngot:  %x\nwant: %x", i, test.in, test.comps, res, test.res)
+		}
+	}
+}
+
+func TestHintsData(t *testing.T) {
+	tests := []struct {
+		in    string
+		comps CompMap
+		res   []string
+	}{
+		{
+			"\x01\x02\x03",
+			CompMap{0x02: uint64Set{0xab: true}},
+			[]string{"\x01\xab\x03"},
+		},
+		{
+			"\x01\x02\x03\x04",
+			CompMap{0x04030201: uint64Set{0xdeadbeef: true}},
+			[]string{"\xef\xbe\xad\xde"},
+		},
+	}
+	for i, test := range tests {
+		arg := dataArg(nil, []byte(test.in))
+		var res []string
+		checkDataArg(arg, test.comps, func() {
+			res = append(res, string(arg.Data))
+		})
+		if !reflect.DeepEqual(res, test.res) {
+			t.Errorf("test #%v: got %q, want %q", i, res, test.res)
+		}
+		if string(arg.Data) != test.in {
+			t.Errorf("test #%v: data is not restored: %q", i, arg.Data)
+		}
+	}
+}
+
+func TestHintsRandom(t *testing.T) {
+	rs, iters := initTest(t)
+	for i := 0; i < iters; i++ {
+		p := Generate(rs, 5, nil)
+		data0 := p.Serialize()
+		for ci, c := range p.Calls {
+			comps := make(CompMap)
+			foreachArg(c, func(arg, _ *Arg, _ *[]*Arg) {
+				if arg.Kind == ArgConst {
+					comps.AddComp(uint64(arg.Val), 0xdeadbeef)
+				}
+			})
+			p.MutateWithHints(ci, comps, func(p1 *Prog) {
+				if err := p1.validate(); err != nil {
+					t.Fatalf("invalid hints candidate: %v", err)
+				}
+			})
+		}
+		if data := p.Serialize(); string(data) != string(data0) {
+			t.Fatalf("program changed after MutateWithHints\noriginal:\n%s\n\nnew:\n%s\n", data0, data)
+		}
+	}
+}
+
+func TestHintsCompMapString(t *testing.T) {
+	m := make(CompMap)
+	m.AddComp(2, 3)
+	m.AddComp(1, 5)
+	m.AddComp(1, 4)
+	if got, want := m.String(), "0x1: 0x4 0x5, 0x2: 0x3"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestHintsSanitize(t *testing.T) {
+	// Sanitization of a candidate with non-loop dev turns block mode into regular file,
+	// this must not leak into subsequent candidates.
+	p, err := Deserialize([]byte(`mknod(&(0x7f0000000000)="2e2f66696c653000", 0x6000, 0x700)`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	comps := make(CompMap)
+	comps.AddComp(0x700, 0x600)
+	comps.AddComp(0x700, 0x701)
+	n := 0
+	p.MutateWithHints(0, comps, func(p1 *Prog) {
+		n++
+		mode, dev := p1.Calls[0].Args[1].Val, p1.Calls[0].Args[2].Val
+		if isBlock := mode&sys.S_IFBLK == sys.S_IFBLK; isBlock != (dev>>8 == 7) {
+			t.Fatalf("bad candidate mode 0x%x for dev 0x%x", mode, dev)
+		}
+	})
+	if n == 0 {
+		t.Fatalf("no candidates")
+	}
+}
@@ -13,6 +13,10 @@ import (
 )
 
 func (p *Prog) Mutate(rs rand.Source, ncalls int, ct *ChoiceTable, corpus []*Prog) {
+	p.mutate(rs, ncalls, ct, corpus, nil)
+}
+
+func (p *Prog) mutate(rs rand.Source, ncalls int, ct *ChoiceTable, corpus []*Prog, trace *MutationTrace) {
 	r := newRand(rs)
 
 	retry := false
@@ -25,13 +29,34 @@ func (p *Prog) Mutate(rs rand.Source, ncalls int, ct *ChoiceTable, corpus []*Pro
 				retry = true
 				continue
 			}
-			p0 := corpus[r.Intn(len(corpus))]
-			p0c := p0.Clone()
-			idx := r.Intn(len(p.Calls))
-			p.Calls = append(p.Calls[:idx], append(p0c.Calls, p.Calls[idx:]...)...)
-			if len(p.Calls) > ncalls {
-				p.Calls = p.Calls[:ncalls]
+			corpusIdx := r.Intn(len(corpus))
+			if len(corpus[corpusIdx].Calls) == 0 {
+				retry = true
+				continue
+			}
+			idx, n, rewired := r.crossover(p, corpus[corpusIdx], ncalls)
+			if trace != nil {
+				// Spliced calls can be partially truncated to ncalls.
+				begin, end := idx, idx+n
+				if end > len(p.Calls) {
+					end = len(p.Calls)
+				}
+				if begin > end {
+					begin = end
+				}
+				trace.add(Mutation{Kind: MutationSplice, Call: idx, Ncalls: n, Corpus: corpusIdx,
+					Rewired: rewired, Text: callsText(p, begin, end)})
+			}
+		case r.nOutOf(1, 50):
+			// Make a call async or synchronous.
+			if len(p.Calls) == 0 {
+				retry = true
+				continue
 			}
+			idx := r.Intn(len(p.Calls))
+			c := p.Calls[idx]
+			c.Async = !c.Async
+			trace.add(Mutation{Kind: MutationToggleAsync, Call: idx, Name: c.Meta.Name})
 		case r.nOutOf(20, 31):
 			// Insert a new call.
 			if len(p.Calls) >= ncalls {
@@ -46,13 +71,19 @@ func (p *Prog) Mutate(rs rand.Source, ncalls int, ct *ChoiceTable, corpus []*Pro
 			s := analyze(ct, p, c)
 			calls := r.generateCall(s, p)
 			p.insertBefore(c, calls)
+			if trace != nil {
+				trace.add(Mutation{Kind: MutationInsertCall, Call: idx + len(calls) - 1,
+					Name: calls[len(calls)-1].Meta.Name, Ncalls: len(calls),
+					Text: callsText(p, idx, idx+len(calls))})
+			}
 		case r.nOutOf(10, 11):
 			// Change args of a call.
 			if len(p.Calls) == 0 {
 				retry = true
 				continue
 			}
-			c := p.Calls[r.Intn(len(p.Calls))]
+			callIdx := r.Intn(len(p.Calls))
+			c := p.Calls[callIdx]
 			if len(c.Args) == 0 {
 				retry = true
 				continue
@@ -66,6 +97,11 @@ func (p *Prog) Mutate(rs rand.Source, ncalls int, ct *ChoiceTable, corpus []*Pro
 				}
 				idx := r.Intn(len(args))
 				arg, base := args[idx], bases[idx]
+				m := Mutation{Kind: MutationMutateArg, Name: c.Meta.Name}
+				if trace != nil {
+					m.Arg = argPath(c, arg)
+					m.Old = diffValue(arg, argRefs(p))
+				}
 				var baseSize uintptr
 				if base != nil {
 					if base.Kind != ArgPointer || base.Res == nil {
@@ -78,20 +114,30 @@ func (p *Prog) Mutate(rs rand.Source, ncalls int, ct *ChoiceTable, corpus []*Pro
 					if r.bin() {
 						arg1, calls1 := r.generateArg(s, arg.Type)
 						p.replaceArg(c, arg, arg1, calls1)
+						m.Op = "regenerate"
 					} else {
 						switch {
 						case r.nOutOf(1, 3):
 							arg.Val += uintptr(r.Intn(4)) + 1
+							m.Op = "increment"
 						case r.nOutOf(1, 2):
 							arg.Val -= uintptr(r.Intn(4)) + 1
+							m.Op = "decrement"
 						default:
 							arg.Val ^= 1 << uintptr(r.Intn(64))
+							m.Op = "flip bit"
 						}
 					}
 				case *sys.ResourceType, *sys.VmaType, *sys.ProcType:
 					arg1, calls1 := r.generateArg(s, arg.Type)
 					p.replaceArg(c, arg, arg1, calls1)
+					m.Op = "regenerate"
 				case *sys.BufferType:
+					if arg1 := r.dictArg(s, a); arg1 != nil && arg.Kind == ArgData {
+						arg.Data = arg1.Data
+						m.Op = "dictionary"
+						break
+					}
 					switch a.Kind {
 					case sys.BufferBlobRand, sys.BufferBlobRange:
 						var data []byte
@@ -113,6 +159,7 @@ func (p *Prog) Mutate(rs rand.Source, ncalls int, ct *ChoiceTable, corpus []*Pro
 							maxLen = int(a.RangeEnd)
 						}
 						arg.Data = mutateData(r, data, minLen, maxLen)
+						m.Op = "mutate data"
 					case sys.BufferString:
 						if r.bin() {
 							minLen := int(0)
@@ -122,13 +169,17 @@ func (p *Prog) Mutate(rs rand.Source, ncalls int, ct *ChoiceTable, corpus []*Pro
 								maxLen = int(a.Length)
 							}
 							arg.Data = mutateData(r, append([]byte{}, arg.Data...), minLen, maxLen)
+							m.Op = "mutate data"
 						} else {
 							arg.Data = r.randString(s, a.Values, a.Dir())
+							m.Op = "regenerate"
 						}
 					case sys.BufferFilename:
 						arg.Data = []byte(r.filename(s))
+						m.Op = "regenerate"
 					case sys.BufferText:
 						arg.Data = r.mutateText(a.Text, arg.Data)
+						m.Op = "mutate text"
 					default:
 						panic("unknown buffer kind")
 					}
@@ -147,6 +198,7 @@ func (p *Prog) Mutate(rs rand.Source, ncalls int, ct *ChoiceTable, corpus []*Pro
 							count = r.randRange(int(a.RangeBegin), int(a.RangeEnd))
 						}
 					}
+					m.Op = "resize"
 					if count > uintptr(len(arg.Inner)) {
 						var calls []*Call
 						for count > uintptr(len(arg.Inner)) {
@@ -177,6 +229,7 @@ func (p *Prog) Mutate(rs rand.Source, ncalls int, ct *ChoiceTable, corpus []*Pro
 					}
 					arg1, calls1 := r.addr(s, a, size, arg.Res)
 					p.replaceArg(c, arg, arg1, calls1)
+					m.Op = "change address"
 				case *sys.StructType:
 					ctor := isSpecialStruct(a)
 					if ctor == nil {
@@ -187,6 +240,7 @@ func (p *Prog) Mutate(rs rand.Source, ncalls int, ct *ChoiceTable, corpus []*Pro
 						p.replaceArg(c, arg.Inner[i], f, calls1)
 						calls1 = nil
 					}
+					m.Op = "regenerate"
 				case *sys.UnionType:
 					optType := a.Options[r.Intn(len(a.Options))]
 					maxIters := 1000
@@ -200,6 +254,7 @@ func (p *Prog) Mutate(rs rand.Source, ncalls int, ct *ChoiceTable, corpus []*Pro
 					opt, calls := r.generateArg(s, optType)
 					arg1 := unionArg(a, opt, optType)
 					p.replaceArg(c, arg, arg1, calls)
+					m.Op = "change option"
 				case *sys.LenType:
 					panic("bad arg returned by mutationArgs: LenType")
 				case *sys.CsumType:
@@ -224,6 +279,16 @@ func (p *Prog) Mutate(rs rand.Source, ncalls int, ct *ChoiceTable, corpus []*Pro
 
 				// Update all len fields.
 				assignSizesCall(c)
+
+				// The call is shifted by the calls inserted before it.
+				for callIdx < len(p.Calls) && p.Calls[callIdx] != c {
+					callIdx++
+				}
+				m.Call = callIdx
+				if trace != nil {
+					m.New = diffValue(arg, argRefs(p))
+					trace.add(m)
+				}
 			}
 		default:
 			// Remove a random call.
@@ -232,6 +297,10 @@ func (p *Prog) Mutate(rs rand.Source, ncalls int, ct *ChoiceTable, corpus []*Pro
 				continue
 			}
 			idx := r.Intn(len(p.Calls))
+			if trace != nil {
+				trace.add(Mutation{Kind: MutationRemoveCall, Call: idx, Name: p.Calls[idx].Meta.Name,
+					Text: callsText(p, idx, idx+1)})
+			}
 			p.removeCall(idx)
 		}
 	}
@@ -311,6 +380,19 @@ func Minimize(p0 *Prog, callIndex0 int, pred func(*Prog, int) bool, crash bool)
 		callIndex0 = callIndex
 	}
 
+	// Try to make async calls synchronous one-by-one,
+	// so that only the calls that need to run in parallel stay async.
+	for i := len(p0.Calls) - 1; i >= 0; i-- {
+		if !p0.Calls[i].Async {
+			continue
+		}
+		p := p0.Clone()
+		p.Calls[i].Async = false
+		if pred(p, callIndex0) {
+			p0 = p
+		}
+	}
+
 	var triedPaths map[string]bool
 
 	var rec func(p *Prog, call *Call, arg *Arg, path string) bool
@@ -318,6 +400,27 @@ func Minimize(p0 *Prog, callIndex0 int, pred func(*Prog, int) bool, crash bool)
 		path += fmt.Sprintf("-%v", arg.Type.FieldName())
 		switch typ := arg.Type.(type) {
 		case *sys.StructType:
+			// Try to reset all scalar fields at once first,
+			// this is much cheaper than resetting them one-by-one.
+			if !triedPaths[path] {
+				triedPaths[path] = true
+				changed := false
+				for _, innerArg := range arg.Inner {
+					switch innerArg.Type.(type) {
+					case *sys.IntType, *sys.FlagsType, *sys.ProcType:
+						if innerArg.Kind == ArgConst && innerArg.Val != innerArg.Type.Default() {
+							innerArg.Val = innerArg.Type.Default()
+							changed = true
+						}
+					}
+				}
+				if changed {
+					if pred(p, callIndex0) {
+						p0 = p
+					}
+					return true
+				}
+			}
 			for _, innerArg := range arg.Inner {
 				if rec(p, call, innerArg, path) {
 					return true
@@ -328,11 +431,48 @@ func Minimize(p0 *Prog, callIndex0 int, pred func(*Prog, int) bool, crash bool)
 				return true
 			}
 		case *sys.PtrType:
-			// TODO: try to remove optional ptrs
+			// Try to replace optional ptrs with NULL.
+			if typ.Optional() && arg.Kind == ArgPointer && arg.Res != nil && !triedPaths[path] {
+				triedPaths[path] = true
+				p.removeArg(call, arg.Res)
+				p.replaceArg(call, arg, constArg(typ, 0), nil)
+				assignSizesCall(call)
+				if pred(p, callIndex0) {
+					p0 = p
+				}
+				return true
+			}
 			if arg.Res != nil {
 				return rec(p, call, arg.Res, path)
 			}
 		case *sys.ArrayType:
+			// Try to drop the array tail in large chunks first.
+			// In crash mode we only try to drop all removable elements at once,
+			// because every predicate invocation is expensive.
+			minLen := 0
+			if typ.Kind == sys.ArrayRangeLen {
+				minLen = int(typ.RangeBegin)
+			}
+			for step := len(arg.Inner) - minLen; step > 0; step /= 2 {
+				tailPath := fmt.Sprintf("%v-tail%v-%v", path, len(arg.Inner), step)
+				if triedPaths[tailPath] {
+					if crash {
+						break
+					}
+					continue
+				}
+				triedPaths[tailPath] = true
+				newLen := len(arg.Inner) - step
+				for _, innerArg := range arg.Inner[newLen:] {
+					p.removeArg(call, innerArg)
+				}
+				arg.Inner = arg.Inner[:newLen]
+				assignSizesCall(call)
+				if pred(p, callIndex0) {
+					p0 = p
+				}
+				return true
+			}
 			for i, innerArg := range arg.Inner {
 				innerPath := fmt.Sprintf("%v-%v", path, i)
 				if !triedPaths[innerPath] && !crash {
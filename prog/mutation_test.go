@@ -6,6 +6,8 @@ package prog
 import (
 	"bytes"
 	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -255,6 +257,31 @@ func TestMinimize(t *testing.T) {
 				"getpid()\n",
 			2,
 		},
+		// Reset struct fields and remove optional pointers.
+		{
+			"mmap(&(0x7f0000000000/0x2000)=nil, (0x2000), 0x3, 0x32, 0xffffffffffffffff, 0x0)\n" +
+				"setitimer(0x1, &(0x7f0000000000)={{0x1, 0x2}, {0x3, 0x4}}, &(0x7f0000001000)={{0x0, 0x0}, {0x0, 0x0}})\n",
+			1,
+			func(p *Prog, callIndex int) bool {
+				return len(p.Calls) == 2
+			},
+			"mmap(&(0x7f0000000000/0x2000)=nil, (0x2000), 0x0, 0x0, 0xffffffffffffffff, 0x0)\n" +
+				"setitimer(0x0, &(0x7f0000000000)={{0x0, 0x0}, {0x0, 0x0}}, 0x0)\n",
+			1,
+		},
+		// Remove array elements.
+		{
+			"mmap(&(0x7f0000000000/0x2000)=nil, (0x2000), 0x3, 0x32, 0xffffffffffffffff, 0x0)\n" +
+				"writev(0xffffffffffffffff, &(0x7f0000000000)=[{&(0x7f0000001000)=\"11\", 0x1}, {&(0x7f0000001000)=\"22\", 0x1}, {&(0x7f0000001000)=\"33\", 0x1}], 0x3)\n",
+			1,
+			func(p *Prog, callIndex int) bool {
+				// Keep the first element.
+				return len(p.Calls) == 2 && len(p.Calls[1].Args[1].Res.Inner) != 0
+			},
+			"mmap(&(0x7f0000000000/0x2000)=nil, (0x2000), 0x0, 0x0, 0xffffffffffffffff, 0x0)\n" +
+				"writev(0xffffffffffffffff, &(0x7f0000000000)=[{&(0x7f0000001000)=\"\", 0x0}], 0x1)\n",
+			1,
+		},
 	}
 	for ti, test := range tests {
 		p, err := Deserialize([]byte(test.orig))
@@ -274,6 +301,51 @@ func TestMinimize(t *testing.T) {
 	}
 }
 
+func TestMinimizeCrash(t *testing.T) {
+	tests := []struct {
+		orig   string
+		result string
+		npred  int
+	}{
+		// Struct fields are reset and optional pointers are removed,
+		// but individual ints are not touched.
+		{
+			"mmap(&(0x7f0000000000/0x2000)=nil, (0x2000), 0x3, 0x32, 0xffffffffffffffff, 0x0)\n" +
+				"setitimer(0x1, &(0x7f0000000000)={{0x1, 0x2}, {0x3, 0x4}}, &(0x7f0000001000)={{0x0, 0x0}, {0x0, 0x0}})\n",
+			"mmap(&(0x7f0000000000/0x2000)=nil, (0x2000), 0x3, 0x32, 0xffffffffffffffff, 0x0)\n" +
+				"setitimer(0x1, &(0x7f0000000000)={{0x0, 0x0}, {0x0, 0x0}}, 0x0)\n",
+			5,
+		},
+		// All array elements are removed at once.
+		{
+			"mmap(&(0x7f0000000000/0x2000)=nil, (0x2000), 0x3, 0x32, 0xffffffffffffffff, 0x0)\n" +
+				"writev(0xffffffffffffffff, &(0x7f0000000000)=[{&(0x7f0000001000)=\"11\", 0x1}, {&(0x7f0000001000)=\"22\", 0x1}, {&(0x7f0000001000)=\"33\", 0x1}], 0x3)\n",
+			"mmap(&(0x7f0000000000/0x2000)=nil, (0x2000), 0x3, 0x32, 0xffffffffffffffff, 0x0)\n" +
+				"writev(0xffffffffffffffff, &(0x7f0000000000)=[], 0x0)\n",
+			3,
+		},
+	}
+	for ti, test := range tests {
+		p, err := Deserialize([]byte(test.orig))
+		if err != nil {
+			t.Fatalf("failed to deserialize original program #%v: %v", ti, err)
+		}
+		npred := 0
+		p1, _ := Minimize(p, len(p.Calls)-1, func(p *Prog, callIndex int) bool {
+			npred++
+			return len(p.Calls) == 2
+		}, true)
+		res := p1.Serialize()
+		if string(res) != test.result {
+			t.Fatalf("minimization produced wrong result #%v\norig:\n%v\nexpect:\n%v\ngot:\n%v\n",
+				ti, test.orig, test.result, string(res))
+		}
+		if npred != test.npred {
+			t.Fatalf("minimization #%v invoked predicate %v times, expected %v", ti, npred, test.npred)
+		}
+	}
+}
+
 func TestMinimizeRandom(t *testing.T) {
 	rs, iters := initTest(t)
 	for i := 0; i < iters; i++ {
@@ -307,3 +379,84 @@ func TestMinimizeRandom(t *testing.T) {
 		}, false)
 	}
 }
+
+func TestMutateTraced(t *testing.T) {
+	rs, iters := initTest(t)
+	r := newRand(rs)
+	for i := 0; i < iters; i++ {
+		p := Generate(rs, 10, nil)
+		corpus := []*Prog{Generate(rs, 5, nil)}
+		seed := r.Int63()
+		p1 := p.Clone()
+		trace := p1.MutateTraced(seed, 10, nil, corpus)
+		if len(trace.Mutations) == 0 {
+			t.Fatalf("no mutations recorded")
+		}
+		for _, m := range trace.Mutations {
+			switch m.Kind {
+			case MutationInsertCall, MutationRemoveCall:
+				if m.Text == "" {
+					t.Fatalf("no calls recorded for %v", m)
+				}
+			case MutationMutateArg:
+				if m.Arg == "" || m.Op == "" || m.Old == "" || m.New == "" {
+					t.Fatalf("incomplete arg mutation: %+v", m)
+				}
+			}
+		}
+		// Mutation with the same seed gives the same result and trace.
+		p2 := p.Clone()
+		trace2 := p2.MutateTraced(seed, 10, nil, corpus)
+		if data1, data2 := p1.Serialize(), p2.Serialize(); !bytes.Equal(data1, data2) {
+			t.Fatalf("mutation is not deterministic\ntrace:\n%v\nfirst:\n%s\n\nsecond:\n%s\n", trace, data1, data2)
+		}
+		if !reflect.DeepEqual(trace, trace2) {
+			t.Fatalf("trace is not deterministic\nfirst:\n%v\nsecond:\n%v", trace, trace2)
+		}
+	}
+}
+
+func TestGenerateTraced(t *testing.T) {
+	rs, iters := initTest(t)
+	r := newRand(rs)
+	for i := 0; i < iters; i++ {
+		p, trace := GenerateTraced(r.Int63(), 10, nil)
+		ncalls := 0
+		for _, m := range trace.Mutations {
+			if m.Kind != MutationInsertCall {
+				t.Fatalf("unexpected mutation: %v", m)
+			}
+			ncalls += m.Ncalls
+			if p.Calls[m.Call].Meta.Name != m.Name || strings.Count(m.Text, "\n") != m.Ncalls {
+				t.Fatalf("bad insertion %v in program:\n%s", m, p.Serialize())
+			}
+		}
+		// Generated calls are only appended, so inserted calls add up to the program.
+		if ncalls != len(p.Calls) {
+			t.Fatalf("trace has %v calls, program has %v\ntrace:\n%v", ncalls, len(p.Calls), trace)
+		}
+	}
+}
+
+func TestArgPath(t *testing.T) {
+	p, err := Deserialize([]byte("writev(0xffffffffffffffff, &(0x7f0000000000)=[{&(0x7f0000001000)=\"11\", 0x1}, {&(0x7f0000001000)=\"22\", 0x1}], 0x2)\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := p.Calls[0]
+	tests := []struct {
+		arg  *Arg
+		path string
+	}{
+		{c.Args[0], "fd"},
+		{c.Args[1], "vec"},
+		{c.Args[1].Res.Inner[1], "vec*[1]"},
+		{c.Args[1].Res.Inner[1].Inner[1], "vec*[1].len"},
+		{c.Args[2], "vlen"},
+	}
+	for _, test := range tests {
+		if path := argPath(c, test.arg); path != test.path {
+			t.Errorf("got path %q, want %q", path, test.path)
+		}
+	}
+}
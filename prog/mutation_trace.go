@@ -0,0 +1,209 @@
+// Copyright 2017 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"github.com/google/syzkaller/sys"
+)
+
+type MutationKind int
+
+const (
+	MutationSplice MutationKind = iota
+	MutationInsertCall
+	MutationMutateArg
+	MutationRemoveCall
+	MutationToggleAsync
+)
+
+func (k MutationKind) String() string {
+	switch k {
+	case MutationSplice:
+		return "splice"
+	case MutationInsertCall:
+		return "insert"
+	case MutationMutateArg:
+		return "mutate"
+	case MutationRemoveCall:
+		return "remove"
+	case MutationToggleAsync:
+		return "async"
+	default:
+		return fmt.Sprintf("MutationKind(%v)", int(k))
+	}
+}
+
+// Mutation describes a single mutation operator applied to a program.
+type Mutation struct {
+	Kind MutationKind
+	// Call is the index of the inserted, mutated or removed call
+	// in the program right after the mutation (or before it for removal).
+	// For splice it is the position where the calls were inserted.
+	Call int
+	// Name is the syscall name of the affected call (except for splice).
+	Name string
+	// Ncalls is the number of inserted calls for splice and insert
+	// (insert can additionally create calls that produce required resources).
+	Ncalls int
+	// Corpus is the index of the spliced program in the corpus.
+	Corpus int
+	// Rewired is the number of resource args of the spliced calls
+	// that were rewired to resources of the program.
+	Rewired int
+	// Arg is the path to the mutated arg within the call (see argPath).
+	Arg string
+	// Op is the arg mutation operator (e.g. "increment" or "resize").
+	Op string
+	// Old and New are values of the mutated arg before and after the mutation
+	// (see diffValue, results are referenced as #call.path).
+	Old, New string
+	// Text is the serialized inserted calls (for splice and insert) or the removed call.
+	Text string
+}
+
+func (m Mutation) String() string {
+	switch m.Kind {
+	case MutationSplice:
+		return fmt.Sprintf("splice %v calls from corpus program #%v at #%v (rewired %v args):\n%v",
+			m.Ncalls, m.Corpus, m.Call, m.Rewired, m.Text)
+	case MutationInsertCall:
+		return fmt.Sprintf("insert #%v %v (%v calls):\n%v", m.Call, m.Name, m.Ncalls, m.Text)
+	case MutationMutateArg:
+		return fmt.Sprintf("mutate #%v %v arg %v (%v): %v -> %v", m.Call, m.Name, m.Arg, m.Op, m.Old, m.New)
+	case MutationRemoveCall:
+		return fmt.Sprintf("remove #%v %v:\n%v", m.Call, m.Name, m.Text)
+	case MutationToggleAsync:
+		return fmt.Sprintf("toggle async #%v %v", m.Call, m.Name)
+	default:
+		return fmt.Sprintf("unknown mutation %v", int(m.Kind))
+	}
+}
+
+// MutationTrace is a record of mutations done by MutateTraced (or of calls
+// inserted by GenerateTraced). It explains how the resulting program was
+// obtained from the base program, but it's not a patch that can be applied
+// to a program. Mutation and generation are deterministic given the seed and
+// the rest of the inputs, so the same result is obtained by calling
+// MutateTraced/GenerateTraced with the same seed again.
+type MutationTrace struct {
+	Seed      int64
+	Mutations []Mutation
+}
+
+func (t *MutationTrace) add(m Mutation) {
+	if t == nil {
+		return
+	}
+	t.Mutations = append(t.Mutations, m)
+}
+
+func (t *MutationTrace) String() string {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "seed %v\n", t.Seed)
+	for _, m := range t.Mutations {
+		fmt.Fprintf(buf, "%v\n", strings.TrimSuffix(m.String(), "\n"))
+	}
+	return buf.String()
+}
+
+// MutateTraced is like Mutate, but uses a random source created from seed
+// and records all applied mutations.
+func (p *Prog) MutateTraced(seed int64, ncalls int, ct *ChoiceTable, corpus []*Prog) *MutationTrace {
+	trace := &MutationTrace{Seed: seed}
+	p.mutate(rand.NewSource(seed), ncalls, ct, corpus, trace)
+	return trace
+}
+
+// GenerateTraced is like Generate, but uses a random source created from seed
+// and records the generated calls as insertions.
+func GenerateTraced(seed int64, ncalls int, ct *ChoiceTable) (*Prog, *MutationTrace) {
+	trace := &MutationTrace{Seed: seed}
+	p := generate(rand.NewSource(seed), ncalls, ct, trace)
+	return p, trace
+}
+
+// callsText returns serialized calls [from, to) of p.
+func callsText(p *Prog, from, to int) string {
+	lines := strings.SplitAfter(string(p.Serialize()), "\n")
+	return strings.Join(lines[from:to], "")
+}
+
+// argPath returns a human-readable path to arg within call c,
+// e.g. "vec*[1].addr" for field addr of the second element of array
+// pointed to by call argument vec.
+func argPath(c *Call, arg *Arg) string {
+	res := ""
+	foreachArgPath(c, func(arg1 *Arg, path string) {
+		if arg1 == arg && res == "" {
+			res = path
+		}
+	})
+	if res == "" {
+		panic("arg is not found in call")
+	}
+	return res
+}
+
+func fieldName(typ sys.Type, idx int) string {
+	if name := typ.FieldName(); name != "" {
+		return name
+	}
+	return fmt.Sprint(idx)
+}
+
+// argRefs maps all args of p to references to them in the form #call.path.
+func argRefs(p *Prog) map[*Arg]string {
+	refs := make(map[*Arg]string)
+	for i, c := range p.Calls {
+		foreachArgPath(c, func(arg *Arg, path string) {
+			refs[arg] = argRef(i, path)
+		})
+	}
+	return refs
+}
+
+func argRef(call int, path string) string {
+	return fmt.Sprintf("#%v.%v", call, path)
+}
+
+// diffValue returns a short representation of the arg value (without inner args).
+func diffValue(a *Arg, refs map[*Arg]string) string {
+	if a == nil {
+		return "nil"
+	}
+	switch a.Kind {
+	case ArgConst:
+		return fmt.Sprintf("0x%x", a.Val)
+	case ArgResult:
+		res := refs[a.Res]
+		if a.OpDiv != 0 {
+			res += fmt.Sprintf("/%v", a.OpDiv)
+		}
+		if a.OpAdd != 0 {
+			res += fmt.Sprintf("+%v", a.OpAdd)
+		}
+		return res
+	case ArgPointer:
+		return "&" + serializeAddr(a, true)
+	case ArgPageSize:
+		return serializeAddr(a, false)
+	case ArgData:
+		return fmt.Sprintf("\"%v\"", hex.EncodeToString(a.Data))
+	case ArgGroup:
+		if _, ok := a.Type.(*sys.ArrayType); ok {
+			return fmt.Sprintf("[%v elements]", len(a.Inner))
+		}
+		return "{...}"
+	case ArgUnion:
+		return "@" + a.OptionType.FieldName()
+	default:
+		return fmt.Sprintf("kind %v", a.Kind)
+	}
+}
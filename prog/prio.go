@@ -194,12 +194,24 @@ func normalizePrio(prios [][]float32) {
 	}
 }
 
+// ApplyCallWeights scales priorities of choosing calls with the given IDs
+// (weights map call ID to weight), so that the weighted calls are chosen
+// more or less often regardless of the preceding call.
+func ApplyCallWeights(prios [][]float32, weights map[int]float32) {
+	for id, w := range weights {
+		for i := range prios {
+			prios[i][id] *= w
+		}
+	}
+}
+
 // ChooseTable allows to do a weighted choice of a syscall for a given syscall
 // based on call-to-call priorities and a set of enabled syscalls.
 type ChoiceTable struct {
 	run          [][]int
 	enabledCalls []*sys.Call
 	enabled      map[*sys.Call]bool
+	dict         *Dict
 }
 
 func BuildChoiceTable(prios [][]float32, enabled map[*sys.Call]bool) *ChoiceTable {
@@ -222,12 +234,19 @@ func BuildChoiceTable(prios [][]float32, enabled map[*sys.Call]bool) *ChoiceTabl
 		sum := 0
 		for j := range run[i] {
 			if enabled[sys.Calls[j]] {
-				sum += int(prios[i][j] * 1000)
+				// Every enabled call must have a chance to be chosen
+				// (weights can make priorities arbitrary small),
+				// otherwise Choose does not terminate or panics on an empty run.
+				w := int(prios[i][j] * 1000)
+				if w < 1 {
+					w = 1
+				}
+				sum += w
 			}
 			run[i][j] = sum
 		}
 	}
-	return &ChoiceTable{run, enabledCalls, enabled}
+	return &ChoiceTable{run: run, enabledCalls: enabledCalls, enabled: enabled}
 }
 
 func (ct *ChoiceTable) Choose(r *rand.Rand, call int) int {
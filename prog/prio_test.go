@@ -0,0 +1,32 @@
+// Copyright 2017 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/google/syzkaller/sys"
+)
+
+func TestApplyCallWeights(t *testing.T) {
+	rs, _ := initTest(t)
+	r := rand.New(rs)
+	// Choose is cheap, so use enough iterations to make the check stable.
+	const iters = 10000
+	prios := CalculatePriorities(nil)
+	weighted := sys.CallMap["getpid"].ID
+	ApplyCallWeights(prios, map[int]float32{weighted: 1000})
+	ct := BuildChoiceTable(prios, nil)
+	n := 0
+	for i := 0; i < iters; i++ {
+		if ct.Choose(r, r.Intn(len(sys.Calls))) == weighted {
+			n++
+		}
+	}
+	// Without the weight getpid would be chosen with probability ~1/len(sys.Calls).
+	if n < iters/4 {
+		t.Fatalf("weighted call is chosen %v times out of %v", n, iters)
+	}
+}
@@ -17,6 +17,11 @@ type Call struct {
 	Meta *sys.Call
 	Args []*Arg
 	Ret  *Arg
+	// Async calls are started, but not waited for, so the next call runs
+	// concurrently with this one. A sequence of async calls followed by a
+	// non-async call forms a group of calls that run in parallel.
+	// Async calls are executed only in threaded mode.
+	Async bool
 }
 
 type Arg struct {
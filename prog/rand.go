@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"math"
 	"math/rand"
+	"sort"
 	"strings"
 	"sync"
 
@@ -98,7 +99,7 @@ func (r *randGen) randRangeInt(begin int64, end int64) uintptr {
 // probability of n-1 is k times higher than probability of 0.
 func (r *randGen) biasedRand(n, k int) int {
 	nf, kf := float64(n), float64(k)
-	rf := nf * (kf/2 + 1) * rand.Float64()
+	rf := nf * (kf/2 + 1) * r.Float64()
 	bf := (-1 + math.Sqrt(1+2*kf*rf/nf)) * nf / kf
 	return int(bf)
 }
@@ -152,11 +153,7 @@ func (r *randGen) filename(s *state) string {
 	// TODO: support procfs and sysfs
 	dir := "."
 	if r.oneOf(2) && len(s.files) != 0 {
-		files := make([]string, 0, len(s.files))
-		for f := range s.files {
-			files = append(files, f)
-		}
-		dir = files[r.Intn(len(files))]
+		dir = s.fileList[r.Intn(len(s.fileList))]
 		if len(dir) > 0 && dir[len(dir)-1] == 0 {
 			dir = dir[:len(dir)-1]
 		}
@@ -170,11 +167,7 @@ func (r *randGen) filename(s *state) string {
 			}
 		}
 	}
-	files := make([]string, 0, len(s.files))
-	for f := range s.files {
-		files = append(files, f)
-	}
-	return files[r.Intn(len(files))]
+	return s.fileList[r.Intn(len(s.fileList))]
 }
 
 func (r *randGen) randString(s *state, vals []string, dir sys.Dir) []byte {
@@ -193,11 +186,7 @@ func (r *randGen) randStringImpl(s *state, vals []string) []byte {
 	}
 	if len(s.strings) != 0 && r.bin() {
 		// Return an existing string.
-		strings := make([]string, 0, len(s.strings))
-		for s := range s.strings {
-			strings = append(strings, s)
-		}
-		return []byte(strings[r.Intn(len(strings))])
+		return []byte(s.stringList[r.Intn(len(s.stringList))])
 	}
 	dict := []string{"user", "keyring", "trusted", "system", "security", "selinux",
 		"posix_acl_access", "mime_type", "md5sum", "nodev", "self",
@@ -413,6 +402,7 @@ func (r *randGen) createResource(s *state, res *sys.ResourceType) (arg *Arg, cal
 				all = append(all, kind1)
 			}
 		}
+		sort.Strings(all)
 		kind = all[r.Intn(len(all))]
 	}
 	// Find calls that produce the necessary resources.
@@ -438,9 +428,9 @@ func (r *randGen) createResource(s *state, res *sys.ResourceType) (arg *Arg, cal
 		s1.analyze(calls[len(calls)-1])
 		// Now see if we have what we want.
 		var allres []*Arg
-		for kind1, res1 := range s1.resources {
+		for _, kind1 := range s1.resourceList {
 			if sys.IsCompatibleResource(kind, kind1) {
-				allres = append(allres, res1...)
+				allres = append(allres, s1.resources[kind1]...)
 			}
 		}
 		if len(allres) != 0 {
@@ -619,16 +609,20 @@ func (r *randGen) generateArg(s *state, typ sys.Type) (arg *Arg, calls []*Call)
 		return constArg(typ, typ.Default()), nil
 	}
 
+	if arg := r.dictArg(s, typ); arg != nil {
+		return arg, nil
+	}
+
 	switch a := typ.(type) {
 	case *sys.ResourceType:
 		switch {
 		case r.nOutOf(1000, 1011):
 			// Get an existing resource.
 			var allres []*Arg
-			for name1, res1 := range s.resources {
+			for _, name1 := range s.resourceList {
 				if sys.IsCompatibleResource(a.Desc.Name, name1) ||
 					r.oneOf(20) && sys.IsCompatibleResource(a.Desc.Kind[0], name1) {
-					allres = append(allres, res1...)
+					allres = append(allres, s.resources[name1]...)
 				}
 			}
 			if len(allres) != 0 {
@@ -0,0 +1,237 @@
+// Copyright 2017 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"fmt"
+
+	"github.com/google/syzkaller/sys"
+)
+
+// This file contains helpers for DeserializeRepair.
+
+func (p *parser) fixf(msg string, args ...interface{}) {
+	p.fixes = append(p.fixes, fmt.Sprintf("line #%v: %v", p.l, fmt.Sprintf(msg, args...)))
+}
+
+// argFits returns true if an arg starting with character ch can be parsed as typ.
+func argFits(typ sys.Type, ch byte) bool {
+	if ch == 'n' {
+		// Pointees of output pointers may be omitted.
+		return true
+	}
+	if typ == nil {
+		return false
+	}
+	switch typ.(type) {
+	case *sys.StructType:
+		return ch == '{'
+	case *sys.ArrayType:
+		return ch == '[' || ch == '"'
+	case *sys.UnionType:
+		return ch == '@'
+	case *sys.BufferType:
+		return ch == '"'
+	case *sys.PtrType, *sys.VmaType:
+		return ch == '&' || ch == '0'
+	default:
+		return ch == '0' || ch == 'r' || ch == '('
+	}
+}
+
+// repairNil replaces a nil arg in a position where nil is not allowed
+// (everywhere except pointees) with a default arg.
+func (p *parser) repairNil(typ sys.Type, arg *Arg) *Arg {
+	if !p.repair || arg != nil {
+		return arg
+	}
+	p.fixf("replaced nil arg with default %v", typ.Name())
+	return defaultArg(typ)
+}
+
+// skipArg consumes a single arg of any type.
+func (p *parser) skipArg() {
+	if p.Char() == '<' {
+		p.Parse('<')
+		p.Ident()
+		p.Parse('=')
+		p.Parse('>')
+	}
+	switch ch := p.Char(); ch {
+	case '0':
+		p.Ident()
+	case 'r':
+		p.Ident()
+		if p.Char() == '/' {
+			p.Parse('/')
+			p.Ident()
+		}
+		if p.Char() == '+' {
+			p.Parse('+')
+			p.Ident()
+		}
+	case '&':
+		p.Parse('&')
+		if _, _, _, err := parseAddr(p, true); err != nil {
+			p.failf("%v", err)
+			return
+		}
+		p.Parse('=')
+		p.skipArg()
+	case '(':
+		if _, _, _, err := parseAddr(p, false); err != nil {
+			p.failf("%v", err)
+		}
+	case '"':
+		p.Parse('"')
+		if p.Char() != '"' {
+			p.Ident()
+		}
+		p.Parse('"')
+	case '{', '[':
+		end := byte('}')
+		if ch == '[' {
+			end = ']'
+		}
+		p.Parse(ch)
+		for p.Err() == nil && p.Char() != end {
+			p.skipArg()
+			if p.Char() != end {
+				p.Parse(',')
+			}
+		}
+		p.Parse(end)
+	case '@':
+		p.Parse('@')
+		p.Ident()
+		p.Parse('=')
+		p.skipArg()
+	case 'n':
+		p.Parse('n')
+		p.Parse('i')
+		p.Parse('l')
+	default:
+		if p.Err() == nil {
+			p.failf("failed to parse argument at %v", int(ch))
+		}
+	}
+}
+
+// defaultArg returns an arg of type typ with default values
+// that passes validation.
+func defaultArg(typ sys.Type) *Arg {
+	switch t := typ.(type) {
+	case *sys.ConstType:
+		if t.Dir() == sys.DirOut {
+			return constArg(t, t.Default())
+		}
+		return constArg(t, t.Val)
+	case *sys.PtrType:
+		if t.Optional() {
+			return constArg(t, 0)
+		}
+		return pointerArg(t, 0, 0, 0, defaultArg(t.Type))
+	case *sys.VmaType:
+		npages := uintptr(1)
+		if t.RangeBegin > 1 {
+			npages = uintptr(t.RangeBegin)
+		}
+		return pointerArg(t, 0, 0, npages, nil)
+	case *sys.BufferType:
+		var data []byte
+		switch t.Kind {
+		case sys.BufferBlobRange:
+			data = make([]byte, t.RangeBegin)
+		case sys.BufferString:
+			if t.Length != 0 {
+				data = make([]byte, t.Length)
+			} else if len(t.Values) != 0 && t.Dir() != sys.DirOut {
+				data = []byte(t.Values[0])
+			}
+		}
+		return dataArg(t, data)
+	case *sys.StructType:
+		var inner []*Arg
+		for _, fld := range t.Fields {
+			inner = append(inner, defaultArg(fld))
+		}
+		return groupArg(t, inner)
+	case *sys.ArrayType:
+		var inner []*Arg
+		if t.Kind == sys.ArrayRangeLen {
+			for i := uintptr(0); i < t.RangeBegin; i++ {
+				inner = append(inner, defaultArg(t.Type))
+			}
+		}
+		return groupArg(t, inner)
+	case *sys.UnionType:
+		opt := t.Options[0]
+		return unionArg(t, defaultArg(opt), opt)
+	default:
+		return constArg(typ, typ.Default())
+	}
+}
+
+// repairArg fixes values of a parsed arg that don't match current descriptions.
+func (p *parser) repairArg(arg *Arg) {
+	typ := arg.Type
+	if typ.Dir() == sys.DirOut {
+		if _, ok := typ.(*sys.LenType); !ok && arg.Kind == ArgConst &&
+			arg.Val != 0 && arg.Val != typ.Default() {
+			p.fixf("reset output arg %v value 0x%x", typ.Name(), arg.Val)
+			arg.Val = typ.Default()
+		}
+		for _, v := range arg.Data {
+			if v != 0 {
+				p.fixf("reset output arg %v data", typ.Name())
+				arg.Data = make([]byte, len(arg.Data))
+				break
+			}
+		}
+	}
+	switch t := typ.(type) {
+	case *sys.ConstType:
+		if arg.Kind == ArgConst && t.Dir() != sys.DirOut && arg.Val != t.Val {
+			p.fixf("updated const %v value 0x%x -> 0x%x", typ.Name(), arg.Val, t.Val)
+			arg.Val = t.Val
+		}
+	case *sys.ProcType:
+		if arg.Kind == ArgConst && arg.Val >= uintptr(t.ValuesPerProc) {
+			p.fixf("reset proc %v value 0x%x", typ.Name(), arg.Val)
+			arg.Val = 0
+		}
+	case *sys.CsumType:
+		if arg.Val != 0 {
+			p.fixf("reset csum %v value 0x%x", typ.Name(), arg.Val)
+			arg.Val = 0
+		}
+	case *sys.BufferType:
+		if t.Kind == sys.BufferString && t.Length != 0 && len(arg.Data) != int(t.Length) {
+			p.fixf("resized string %v from %v to %v", typ.Name(), len(arg.Data), t.Length)
+			data := make([]byte, t.Length)
+			copy(data, arg.Data)
+			arg.Data = data
+		}
+	case *sys.PtrType:
+		switch arg.Kind {
+		case ArgConst:
+			if !t.Optional() {
+				p.fixf("replaced nil non-optional pointer %v", typ.Name())
+				uses := arg.Uses
+				*arg = *defaultArg(t)
+				arg.Uses = uses
+			}
+		case ArgPointer:
+			if arg.AddrPagesNum != 0 {
+				p.fixf("reset pointer %v size", typ.Name())
+				arg.AddrPagesNum = 0
+			}
+		}
+	case *sys.VmaType:
+		if arg.Kind == ArgPointer && arg.AddrPagesNum == 0 {
+			p.fixf("set vma %v size to 1 page", typ.Name())
+			arg.AddrPagesNum = 1
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2017 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"testing"
+)
+
+func TestDeserializeRepairRandom(t *testing.T) {
+	rs, iters := initTest(t)
+	for i := 0; i < iters; i++ {
+		p := Generate(rs, 10, nil)
+		p.Mutate(rs, 10, nil, nil)
+		data := p.Serialize()
+		p1, fixes, err := DeserializeRepair(data)
+		if err != nil {
+			t.Fatalf("failed to deserialize: %v\n%s", err, data)
+		}
+		if len(fixes) != 0 {
+			t.Fatalf("valid program was repaired: %q\n%s", fixes, data)
+		}
+		if data1 := p1.Serialize(); string(data) != string(data1) {
+			t.Fatalf("program changed after deserialization\noriginal:\n%s\n\nnew:\n%s\n", data, data1)
+		}
+	}
+}
+
+func TestDeserializeRepair(t *testing.T) {
+	tests := []struct {
+		in     string
+		out    string
+		nfixes int
+	}{
+		// Unknown syscall and dangling reference to its result.
+		{
+			"r0 = foobar(0x1)\n" +
+				"close(r0)\n",
+			"close(0xffffffffffffffff)\n",
+			2,
+		},
+		// Excessive and missing call args.
+		{
+			"close(0x1, 0x2)\n" +
+				"pipe2(&(0x7f0000000000)={0x0, 0x0})\n",
+			"close(0x1)\n" +
+				"pipe2(&(0x7f0000000000)={0x0, 0x0}, 0x0)\n",
+			2,
+		},
+		// Excessive and missing struct fields.
+		{
+			"pipe2(&(0x7f0000000000)={0x0, 0x0, 0x0}, 0x0)\n" +
+				"pipe2(&(0x7f0000000000)={0x0}, 0x0)\n",
+			"pipe2(&(0x7f0000000000)={0x0, 0x0}, 0x0)\n" +
+				"pipe2(&(0x7f0000000000)={0x0, 0xffffffffffffffff}, 0x0)\n",
+			2,
+		},
+		// Arg of a wrong kind.
+		{
+			"pipe2({0x0, 0x0}, 0x0)\n",
+			"pipe2(&(0x7f0000000000)={0xffffffffffffffff, 0xffffffffffffffff}, 0x0)\n",
+			1,
+		},
+	}
+	for i, test := range tests {
+		p, fixes, err := DeserializeRepair([]byte(test.in))
+		if err != nil {
+			t.Fatalf("#%v: failed to deserialize: %v", i, err)
+		}
+		if out := string(p.Serialize()); out != test.out {
+			t.Fatalf("#%v: wrong result\ngot:\n%v\nwant:\n%v", i, out, test.out)
+		}
+		if len(fixes) != test.nfixes {
+			t.Fatalf("#%v: got %v fixes, want %v: %q", i, len(fixes), test.nfixes, fixes)
+		}
+		if _, err := Deserialize([]byte(test.in)); err == nil {
+			t.Fatalf("#%v: strict deserialization succeeded", i)
+		}
+	}
+}
@@ -11,232 +11,356 @@ import (
 
 var debug = false // enabled in tests
 
-type validCtx struct {
-	args map[*Arg]bool
-	uses map[*Arg]*Arg
+// ValidationError describes a single problem found in a program.
+type ValidationError struct {
+	Call int    // index of the call, -1 if the problem is not related to a particular call
+	Name string // syscall name
+	Arg  string // path to the arg (see argPath), empty for call-level problems
+	Msg  string
 }
 
+func (e *ValidationError) Error() string {
+	switch {
+	case e.Call == -1:
+		return e.Msg
+	case e.Arg == "":
+		return fmt.Sprintf("call #%v %v: %v", e.Call, e.Name, e.Msg)
+	default:
+		return fmt.Sprintf("call #%v %v: arg %v: %v", e.Call, e.Name, e.Arg, e.Msg)
+	}
+}
+
+// Validate checks the program and returns all found problems.
+// In addition to internal invariants of the program tree, it checks
+// that len args match sizes of the referenced args and that pointers
+// point into the data area. Such programs are not broken (e.g. hints
+// and manual editing produce wrong lens), but generation never produces them,
+// so they can signal bugs in descriptions or encoders.
+// Validate temporarily modifies the program, so it must not be used concurrently.
+func (p *Prog) Validate() []*ValidationError {
+	return p.validateAll(true)
+}
+
+// validate checks internal invariants of the program tree.
 func (p *Prog) validate() error {
-	ctx := &validCtx{make(map[*Arg]bool), make(map[*Arg]*Arg)}
-	for _, c := range p.Calls {
-		if err := c.validate(ctx); err != nil {
-			return err
-		}
+	if errs := p.validateAll(false); len(errs) != 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+type validator struct {
+	strict bool
+	args   map[*Arg]bool
+	uses   map[*Arg]*Arg
+	call   int
+	name   string
+	errs   []*ValidationError
+}
+
+func (p *Prog) validateAll(strict bool) []*ValidationError {
+	v := &validator{
+		strict: strict,
+		args:   make(map[*Arg]bool),
+		uses:   make(map[*Arg]*Arg),
+	}
+	for i, c := range p.Calls {
+		v.call = i
+		v.validateCall(c)
 	}
-	for u, orig := range ctx.uses {
-		if !ctx.args[u] {
-			return fmt.Errorf("use of %+v referes to an out-of-tree arg\narg: %#v", *orig, u)
+	v.call, v.name = -1, ""
+	for u, orig := range v.uses {
+		if !v.args[u] {
+			v.errorf("", "use of %+v referes to an out-of-tree arg\narg: %#v", *orig, u)
 		}
 	}
-	return nil
+	return v.errs
+}
+
+func (v *validator) errorf(path, msg string, args ...interface{}) {
+	v.errs = append(v.errs, &ValidationError{
+		Call: v.call,
+		Name: v.name,
+		Arg:  path,
+		Msg:  fmt.Sprintf(msg, args...),
+	})
 }
 
-func (c *Call) validate(ctx *validCtx) error {
+func (v *validator) validateCall(c *Call) {
+	v.name = ""
 	if c.Meta == nil {
-		return fmt.Errorf("call does not have meta information")
+		v.errorf("", "call does not have meta information")
+		return
 	}
+	v.name = c.Meta.Name
 	if len(c.Args) != len(c.Meta.Args) {
-		return fmt.Errorf("syscall %v: wrong number of arguments, want %v, got %v", c.Meta.Name, len(c.Meta.Args), len(c.Args))
+		v.errorf("", "wrong number of arguments, want %v, got %v", len(c.Meta.Args), len(c.Args))
+		return
 	}
-	var checkArg func(arg *Arg) error
-	checkArg = func(arg *Arg) error {
-		if arg == nil {
-			return fmt.Errorf("syscall %v: nil arg", c.Meta.Name)
+	nerrs := len(v.errs)
+	for i, arg := range c.Args {
+		path := fmt.Sprintf("#%v", i)
+		if arg != nil && arg.Type != nil {
+			path = fieldName(arg.Type, i)
 		}
-		if ctx.args[arg] {
-			return fmt.Errorf("syscall %v: arg is referenced several times in the tree", c.Meta.Name)
+		if arg != nil && arg.Kind == ArgReturn {
+			v.errorf(path, "arg has wrong return kind")
+			continue
 		}
-		ctx.args[arg] = true
-		for u := range arg.Uses {
-			ctx.uses[u] = arg
-		}
-		if arg.Type == nil {
-			return fmt.Errorf("syscall %v: no type", c.Meta.Name)
-		}
-		if arg.Type.Dir() == sys.DirOut {
-			if (arg.Val != 0 && arg.Val != arg.Type.Default()) || arg.AddrPage != 0 || arg.AddrOffset != 0 {
-				// We generate output len arguments, which makes sense
-				// since it can be a length of a variable-length array
-				// which is not known otherwise.
-				if _, ok := arg.Type.(*sys.LenType); !ok {
-					return fmt.Errorf("syscall %v: output arg '%v'/'%v' has non default value '%+v'", c.Meta.Name, arg.Type.FieldName(), arg.Type.Name(), *arg)
-				}
-			}
-			for _, v := range arg.Data {
-				if v != 0 {
-					return fmt.Errorf("syscall %v: output arg '%v' has data", c.Meta.Name, arg.Type.Name())
-				}
+		v.checkArg(arg, path)
+	}
+	if c.Ret == nil {
+		v.errorf("ret", "return value is absent")
+	} else if c.Ret.Kind != ArgReturn {
+		v.errorf("ret", "return value has wrong kind %v", c.Ret.Kind)
+	} else if c.Meta.Ret != nil {
+		v.checkArg(c.Ret, "ret")
+	} else if c.Ret.Type != nil {
+		v.errorf("ret", "return value has spurious type: %+v", c.Ret.Type)
+	}
+	if v.strict && len(v.errs) == nerrs {
+		// Size and address checks work only for structurally valid calls.
+		v.checkSizes(c)
+		v.checkAddrs(c)
+	}
+}
+
+func (v *validator) checkArg(arg *Arg, path string) {
+	if arg == nil {
+		v.errorf(path, "nil arg")
+		return
+	}
+	if v.args[arg] {
+		v.errorf(path, "arg is referenced several times in the tree")
+		return
+	}
+	v.args[arg] = true
+	for u := range arg.Uses {
+		v.uses[u] = arg
+	}
+	if arg.Type == nil {
+		v.errorf(path, "no type")
+		return
+	}
+	name := arg.Type.Name()
+	if arg.Type.Dir() == sys.DirOut {
+		if (arg.Val != 0 && arg.Val != arg.Type.Default()) || arg.AddrPage != 0 || arg.AddrOffset != 0 {
+			// We generate output len arguments, which makes sense
+			// since it can be a length of a variable-length array
+			// which is not known otherwise.
+			if _, ok := arg.Type.(*sys.LenType); !ok {
+				v.errorf(path, "output arg '%v' has non default value '%+v'", name, *arg)
 			}
 		}
-		switch typ1 := arg.Type.(type) {
-		case *sys.IntType:
-			switch arg.Kind {
-			case ArgConst:
-			case ArgResult:
-			case ArgReturn:
-				if arg.Type.Dir() == sys.DirOut && (arg.Val != 0 && arg.Val != arg.Type.Default()) {
-					return fmt.Errorf("syscall %v: out int arg '%v' has bad const value %v", c.Meta.Name, arg.Type.Name(), arg.Val)
-				}
-			default:
-				return fmt.Errorf("syscall %v: int arg '%v' has bad kind %v", c.Meta.Name, arg.Type.Name(), arg.Kind)
-			}
-		case *sys.ResourceType:
-			switch arg.Kind {
-			case ArgResult:
-			case ArgReturn:
-			case ArgConst:
-				if arg.Type.Dir() == sys.DirOut && (arg.Val != 0 && arg.Val != arg.Type.Default()) {
-					return fmt.Errorf("syscall %v: out resource arg '%v' has bad const value %v", c.Meta.Name, arg.Type.Name(), arg.Val)
-				}
-			default:
-				return fmt.Errorf("syscall %v: fd arg '%v' has bad kind %v", c.Meta.Name, arg.Type.Name(), arg.Kind)
-			}
-		case *sys.StructType, *sys.ArrayType:
-			switch arg.Kind {
-			case ArgGroup:
-			default:
-				return fmt.Errorf("syscall %v: struct/array arg '%v' has bad kind %v", c.Meta.Name, arg.Type.Name(), arg.Kind)
-			}
-		case *sys.UnionType:
-			switch arg.Kind {
-			case ArgUnion:
-			default:
-				return fmt.Errorf("syscall %v: union arg '%v' has bad kind %v", c.Meta.Name, arg.Type.Name(), arg.Kind)
-			}
-		case *sys.ProcType:
-			if arg.Val >= uintptr(typ1.ValuesPerProc) {
-				return fmt.Errorf("syscall %v: per proc arg '%v' has bad value '%v'", c.Meta.Name, arg.Type.Name(), arg.Val)
-			}
-		case *sys.BufferType:
-			switch arg.Kind {
-			case ArgData:
-			default:
-				return fmt.Errorf("syscall %v: buffer arg '%v' has bad kind %v", c.Meta.Name, arg.Type.Name(), arg.Kind)
-			}
-			switch typ1.Kind {
-			case sys.BufferString:
-				if typ1.Length != 0 && len(arg.Data) != int(typ1.Length) {
-					return fmt.Errorf("syscall %v: string arg '%v' has size %v, which should be %v", c.Meta.Name, arg.Type.Name(), len(arg.Data), typ1.Length)
-				}
-			}
-		case *sys.CsumType:
-			if arg.Val != 0 {
-				return fmt.Errorf("syscall %v: csum arg '%v' has nonzero value %v", c.Meta.Name, arg.Type.Name(), arg.Val)
-			}
-		case *sys.PtrType:
-			if arg.Type.Dir() == sys.DirOut {
-				return fmt.Errorf("syscall %v: pointer arg '%v' has output direction", c.Meta.Name, arg.Type.Name())
-			}
-			if arg.Res == nil && !arg.Type.Optional() {
-				return fmt.Errorf("syscall %v: non optional pointer arg '%v' is nil", c.Meta.Name, arg.Type.Name())
+		for _, b := range arg.Data {
+			if b != 0 {
+				v.errorf(path, "output arg '%v' has data", name)
+				break
 			}
 		}
+	}
+	switch typ1 := arg.Type.(type) {
+	case *sys.IntType:
 		switch arg.Kind {
 		case ArgConst:
 		case ArgResult:
-			if arg.Res == nil {
-				return fmt.Errorf("syscall %v: result arg '%v' has no reference", c.Meta.Name, arg.Type.Name())
-			}
-			if !ctx.args[arg.Res] {
-				return fmt.Errorf("syscall %v: result arg '%v' references out-of-tree result: %p%+v -> %p%+v",
-					c.Meta.Name, arg.Type.Name(), arg, arg, arg.Res, arg.Res)
-			}
-			if _, ok := arg.Res.Uses[arg]; !ok {
-				return fmt.Errorf("syscall %v: result arg '%v' has broken link (%+v)", c.Meta.Name, arg.Type.Name(), arg.Res.Uses)
-			}
-		case ArgPointer:
-			switch arg.Type.(type) {
-			case *sys.VmaType:
-				if arg.Res != nil {
-					return fmt.Errorf("syscall %v: vma arg '%v' has data", c.Meta.Name, arg.Type.Name())
-				}
-				if arg.AddrPagesNum == 0 {
-					return fmt.Errorf("syscall %v: vma arg '%v' has size 0", c.Meta.Name, arg.Type.Name())
-				}
-			case *sys.PtrType:
-				if arg.Res != nil {
-					if err := checkArg(arg.Res); err != nil {
-						return err
-					}
-				}
-				if arg.AddrPagesNum != 0 {
-					return fmt.Errorf("syscall %v: pointer arg '%v' has nonzero size", c.Meta.Name, arg.Type.Name())
-				}
-			default:
-				return fmt.Errorf("syscall %v: pointer arg '%v' has bad meta type %+v", c.Meta.Name, arg.Type.Name(), arg.Type)
-			}
-		case ArgPageSize:
-		case ArgData:
-			switch typ1 := arg.Type.(type) {
-			case *sys.ArrayType:
-				if typ2, ok := typ1.Type.(*sys.IntType); !ok || typ2.Size() != 1 {
-					return fmt.Errorf("syscall %v: data arg '%v' should be an array", c.Meta.Name, arg.Type.Name())
-				}
+		case ArgReturn:
+			if arg.Type.Dir() == sys.DirOut && (arg.Val != 0 && arg.Val != arg.Type.Default()) {
+				v.errorf(path, "out int arg '%v' has bad const value %v", name, arg.Val)
 			}
-		case ArgGroup:
-			switch typ1 := arg.Type.(type) {
-			case *sys.StructType:
-				if len(arg.Inner) != len(typ1.Fields) {
-					return fmt.Errorf("syscall %v: struct arg '%v' has wrong number of fields: want %v, got %v", c.Meta.Name, arg.Type.Name(), len(typ1.Fields), len(arg.Inner))
-				}
-				for _, arg1 := range arg.Inner {
-					if err := checkArg(arg1); err != nil {
-						return err
-					}
-				}
-			case *sys.ArrayType:
-				for _, arg1 := range arg.Inner {
-					if err := checkArg(arg1); err != nil {
-						return err
-					}
-				}
-			default:
-				return fmt.Errorf("syscall %v: group arg '%v' has bad underlying type %+v", c.Meta.Name, arg.Type.Name(), arg.Type)
+		default:
+			v.errorf(path, "int arg '%v' has bad kind %v", name, arg.Kind)
+		}
+	case *sys.ResourceType:
+		switch arg.Kind {
+		case ArgResult:
+		case ArgReturn:
+		case ArgConst:
+			if arg.Type.Dir() == sys.DirOut && (arg.Val != 0 && arg.Val != arg.Type.Default()) {
+				v.errorf(path, "out resource arg '%v' has bad const value %v", name, arg.Val)
 			}
+		default:
+			v.errorf(path, "fd arg '%v' has bad kind %v", name, arg.Kind)
+		}
+	case *sys.StructType, *sys.ArrayType:
+		switch arg.Kind {
+		case ArgGroup:
+		default:
+			v.errorf(path, "struct/array arg '%v' has bad kind %v", name, arg.Kind)
+		}
+	case *sys.UnionType:
+		switch arg.Kind {
 		case ArgUnion:
-			typ1, ok := arg.Type.(*sys.UnionType)
-			if !ok {
-				return fmt.Errorf("syscall %v: union arg '%v' has bad type", c.Meta.Name, arg.Type.Name())
+		default:
+			v.errorf(path, "union arg '%v' has bad kind %v", name, arg.Kind)
+		}
+	case *sys.ProcType:
+		if arg.Val >= uintptr(typ1.ValuesPerProc) {
+			v.errorf(path, "per proc arg '%v' has bad value '%v'", name, arg.Val)
+		}
+	case *sys.BufferType:
+		switch arg.Kind {
+		case ArgData:
+		default:
+			v.errorf(path, "buffer arg '%v' has bad kind %v", name, arg.Kind)
+		}
+		switch typ1.Kind {
+		case sys.BufferString:
+			if typ1.Length != 0 && len(arg.Data) != int(typ1.Length) {
+				v.errorf(path, "string arg '%v' has size %v, which should be %v", name, len(arg.Data), typ1.Length)
 			}
-			found := false
-			for _, typ2 := range typ1.Options {
-				if arg.OptionType.Name() == typ2.Name() {
-					found = true
-					break
-				}
+		}
+	case *sys.CsumType:
+		if arg.Val != 0 {
+			v.errorf(path, "csum arg '%v' has nonzero value %v", name, arg.Val)
+		}
+	case *sys.PtrType:
+		if arg.Type.Dir() == sys.DirOut {
+			v.errorf(path, "pointer arg '%v' has output direction", name)
+		}
+		if arg.Res == nil && !arg.Type.Optional() {
+			v.errorf(path, "non optional pointer arg '%v' is nil", name)
+		}
+	}
+	switch arg.Kind {
+	case ArgConst:
+	case ArgResult:
+		if arg.Res == nil {
+			v.errorf(path, "result arg '%v' has no reference", name)
+			break
+		}
+		if !v.args[arg.Res] {
+			v.errorf(path, "result arg '%v' references out-of-tree result: %p%+v -> %p%+v",
+				name, arg, arg, arg.Res, arg.Res)
+		}
+		if _, ok := arg.Res.Uses[arg]; !ok {
+			v.errorf(path, "result arg '%v' has broken link (%+v)", name, arg.Res.Uses)
+		}
+	case ArgPointer:
+		switch arg.Type.(type) {
+		case *sys.VmaType:
+			if arg.Res != nil {
+				v.errorf(path, "vma arg '%v' has data", name)
+			}
+			if arg.AddrPagesNum == 0 {
+				v.errorf(path, "vma arg '%v' has size 0", name)
 			}
-			if !found {
-				return fmt.Errorf("syscall %v: union arg '%v' has bad option", c.Meta.Name, arg.Type.Name())
+		case *sys.PtrType:
+			if arg.Res != nil {
+				v.checkArg(arg.Res, path+"*")
 			}
-			if err := checkArg(arg.Option); err != nil {
-				return err
+			if arg.AddrPagesNum != 0 {
+				v.errorf(path, "pointer arg '%v' has nonzero size", name)
 			}
-		case ArgReturn:
 		default:
-			return fmt.Errorf("syscall %v: unknown arg '%v' kind", c.Meta.Name, arg.Type.Name())
+			v.errorf(path, "pointer arg '%v' has bad meta type %+v", name, arg.Type)
 		}
-		return nil
-	}
-	for _, arg := range c.Args {
-		if arg.Kind == ArgReturn {
-			return fmt.Errorf("syscall %v: arg '%v' has wrong return kind", c.Meta.Name, arg.Type.Name())
+	case ArgPageSize:
+	case ArgData:
+		switch typ1 := arg.Type.(type) {
+		case *sys.ArrayType:
+			if typ2, ok := typ1.Type.(*sys.IntType); !ok || typ2.Size() != 1 {
+				v.errorf(path, "data arg '%v' should be an array", name)
+			}
+		}
+	case ArgGroup:
+		switch typ1 := arg.Type.(type) {
+		case *sys.StructType:
+			if len(arg.Inner) != len(typ1.Fields) {
+				v.errorf(path, "struct arg '%v' has wrong number of fields: want %v, got %v",
+					name, len(typ1.Fields), len(arg.Inner))
+				break
+			}
+			for i, arg1 := range arg.Inner {
+				v.checkArg(arg1, path+"."+fieldName(typ1.Fields[i], i))
+			}
+		case *sys.ArrayType:
+			for i, arg1 := range arg.Inner {
+				v.checkArg(arg1, fmt.Sprintf("%v[%v]", path, i))
+			}
+		default:
+			v.errorf(path, "group arg '%v' has bad underlying type %+v", name, arg.Type)
 		}
-		if err := checkArg(arg); err != nil {
-			return err
+	case ArgUnion:
+		typ1, ok := arg.Type.(*sys.UnionType)
+		if !ok {
+			v.errorf(path, "union arg '%v' has bad type", name)
+			break
 		}
+		if arg.OptionType == nil {
+			v.errorf(path, "union arg '%v' has no option", name)
+			break
+		}
+		found := false
+		for _, typ2 := range typ1.Options {
+			if arg.OptionType.Name() == typ2.Name() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.errorf(path, "union arg '%v' has bad option", name)
+		}
+		v.checkArg(arg.Option, path+"."+fieldName(arg.OptionType, 0))
+	case ArgReturn:
+	default:
+		v.errorf(path, "unknown arg '%v' kind", name)
 	}
-	if c.Ret == nil {
-		return fmt.Errorf("syscall %v: return value is absent", c.Meta.Name)
-	}
-	if c.Ret.Kind != ArgReturn {
-		return fmt.Errorf("syscall %v: return value has wrong kind %v", c.Meta.Name, c.Ret.Kind)
+}
+
+// checkSizes checks that len args match sizes of the referenced args.
+func (v *validator) checkSizes(c *Call) {
+	// Recalculate sizes in place and restore the original values afterwards.
+	orig := make(map[*Arg]Arg)
+	paths := make(map[*Arg]string)
+	foreachArgPath(c, func(arg *Arg, path string) {
+		if _, ok := arg.Type.(*sys.LenType); ok {
+			orig[arg] = *arg
+			paths[arg] = path
+		}
+	})
+	if len(orig) == 0 {
+		return
 	}
-	if c.Meta.Ret != nil {
-		if err := checkArg(c.Ret); err != nil {
-			return err
+	assignSizesCall(c)
+	foreachArgPath(c, func(arg *Arg, path string) {
+		old, ok := orig[arg]
+		if !ok {
+			return
 		}
-	} else if c.Ret.Type != nil {
-		return fmt.Errorf("syscall %v: return value has spurious type: %+v", c.Meta.Name, c.Ret.Type)
+		if old.Kind != arg.Kind || old.Val != arg.Val || old.AddrPage != arg.AddrPage ||
+			old.AddrOffset != arg.AddrOffset || old.AddrPagesNum != arg.AddrPagesNum {
+			v.errorf(path, "len arg has value %v, but size of %v is %v",
+				diffValue(&old, nil), arg.Type.(*sys.LenType).Buf, diffValue(arg, nil))
+		}
+	})
+	for arg, old := range orig {
+		*arg = old
 	}
-	return nil
+}
+
+// checkAddrs checks that pointers point into the data area.
+func (v *validator) checkAddrs(c *Call) {
+	foreachArgPath(c, func(arg *Arg, path string) {
+		if arg.Kind != ArgPointer {
+			return
+		}
+		switch arg.Type.(type) {
+		case *sys.VmaType:
+			if arg.AddrPage+arg.AddrPagesNum > maxPages {
+				v.errorf(path, "vma pages [%v, %v) are out of the data area (%v pages)",
+					arg.AddrPage, arg.AddrPage+arg.AddrPagesNum, maxPages)
+			}
+		case *sys.PtrType:
+			addr := physicalAddr(arg) - dataOffset
+			size := uintptr(0)
+			if arg.Res != nil {
+				size = arg.Res.Size()
+			}
+			if addr+size > maxPages*pageSize {
+				v.errorf(path, "pointee [0x%x, 0x%x) is out of the data area (0x%x bytes)",
+					addr, addr+size, maxPages*pageSize)
+			}
+		}
+	})
 }
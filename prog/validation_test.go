@@ -0,0 +1,86 @@
+// Copyright 2017 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateRandom(t *testing.T) {
+	rs, iters := initTest(t)
+	for i := 0; i < iters; i++ {
+		p := Generate(rs, 10, nil)
+		data := p.Serialize()
+		if errs := p.Validate(); len(errs) != 0 {
+			t.Fatalf("generated program is invalid: %v\n%s", errs, data)
+		}
+		if data1 := p.Serialize(); string(data) != string(data1) {
+			t.Fatalf("program changed after validation\noriginal:\n%s\n\nnew:\n%s\n", data, data1)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		prog string
+		errs []string
+	}{
+		{
+			"r0 = open(&(0x7f0000001000)=\"2e2f66696c653000\", 0x0, 0x0)\n" +
+				"read(r0, &(0x7f0000000000)=\"\", 0x0)\n",
+			nil,
+		},
+		{
+			"writev(0xffffffffffffffff, &(0x7f0000000000)=[{&(0x7f0000001000)=\"11\", 0x2}], 0x3)\n",
+			[]string{
+				"call #0 writev: arg vec*[0].len: len arg has value 0x2, but size of addr is 0x1",
+				"call #0 writev: arg vlen: len arg has value 0x3, but size of vec is 0x1",
+			},
+		},
+		{
+			"open(&(0x7f0000fff000+0xffc)=\"2e2f66696c653000\", 0x0, 0x0)\n",
+			[]string{
+				"call #0 open: arg file: pointee [0xfffffc, 0x1000004) is out of the data area (0x1000000 bytes)",
+			},
+		},
+		{
+			"mmap(&(0x7f0000ffe000/0x3000)=nil, (0x3000), 0x3, 0x32, 0xffffffffffffffff, 0x0)\n",
+			[]string{
+				"call #0 mmap: arg addr: vma pages [4094, 4097) are out of the data area (4096 pages)",
+			},
+		},
+	}
+	for i, test := range tests {
+		p, err := Deserialize([]byte(test.prog))
+		if err != nil {
+			t.Fatalf("#%v: failed to deserialize: %v", i, err)
+		}
+		var errs []string
+		for _, err := range p.Validate() {
+			errs = append(errs, err.Error())
+		}
+		if got, want := strings.Join(errs, "\n"), strings.Join(test.errs, "\n"); got != want {
+			t.Fatalf("#%v: got errors:\n%v\nwant:\n%v", i, got, want)
+		}
+	}
+}
+
+func TestValidateAll(t *testing.T) {
+	p, err := Deserialize([]byte("r0 = open(&(0x7f0000001000)=\"2e2f66696c653000\", 0x0, 0x0)\n" +
+		"read(r0, &(0x7f0000000000)=\"\", 0x1)\n"))
+	if err != nil {
+		t.Fatalf("failed to deserialize: %v", err)
+	}
+	// Break both calls, validation must report problems in both.
+	p.Calls[0].Args[0].Res = nil
+	p.Calls[1].Args[1] = nil
+	errs := p.Validate()
+	if len(errs) != 2 || errs[0].Call != 0 || errs[0].Arg != "file" || errs[1].Call != 1 || errs[1].Arg != "#1" {
+		t.Fatalf("got errors: %v", errs)
+	}
+	if err := p.validate(); err == nil || err.Error() != errs[0].Error() {
+		t.Fatalf("validate returned %v, want %v", err, errs[0])
+	}
+}
@@ -176,7 +176,8 @@ type IntType struct {
 
 type FlagsType struct {
 	IntTypeCommon
-	Vals []uintptr
+	Vals     []uintptr
+	ValNames []string // names of Vals as used in descriptions
 }
 
 type LenType struct {
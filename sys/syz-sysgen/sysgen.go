@@ -63,11 +63,13 @@ func main() {
 		unsupported := make(map[string]bool)
 		archFlags := make(map[string][]string)
 		for f, vals := range desc.Flags {
+			// Values are substituted with consts during generation,
+			// names are preserved for FlagsType.ValNames.
 			var archVals []string
 			for _, val := range vals {
 				if isIdentifier(val) {
-					if v, ok := consts[arch.Name][val]; ok {
-						archVals = append(archVals, fmt.Sprint(v))
+					if _, ok := consts[arch.Name][val]; ok {
+						archVals = append(archVals, val)
 					} else {
 						if !unsupported[val] {
 							unsupported[val] = true
@@ -570,14 +572,24 @@ func generateArg(
 				failf("wrong number of arguments for %v arg %v, want %v, got %v", typ, name, want, len(a))
 			}
 		}
-		vals, ok := desc.Flags[a[0]]
+		names, ok := desc.Flags[a[0]]
 		if !ok {
 			failf("unknown flag %v", a[0])
 		}
-		if len(vals) == 0 {
+		if len(names) == 0 {
 			fmt.Fprintf(out, "&IntType{%v}", intCommon(size, bigEndian, bitfieldLen))
 		} else {
-			fmt.Fprintf(out, "&FlagsType{%v, Vals: []uintptr{%v}}", intCommon(size, bigEndian, bitfieldLen), strings.Join(vals, ","))
+			var vals, quoted []string
+			for _, name := range names {
+				val := name
+				if isIdentifier(name) {
+					val = fmt.Sprint(consts[name])
+				}
+				vals = append(vals, val)
+				quoted = append(quoted, strconv.Quote(name))
+			}
+			fmt.Fprintf(out, "&FlagsType{%v, Vals: []uintptr{%v}, ValNames: []string{%v}}",
+				intCommon(size, bigEndian, bitfieldLen), strings.Join(vals, ","), strings.Join(quoted, ","))
 		}
 	case "const":
 		canBeArg = true
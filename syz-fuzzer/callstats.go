@@ -0,0 +1,179 @@
+// Copyright 2017 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/syzkaller/pkg/ipc"
+	. "github.com/google/syzkaller/pkg/log"
+	. "github.com/google/syzkaller/pkg/rpctype"
+	"github.com/google/syzkaller/prog"
+	"github.com/google/syzkaller/sys"
+)
+
+const (
+	// Calls that were executed at least failingCallExecs times and never succeeded
+	// are chosen failingCallWeight times less often. They are not disabled
+	// completely because they may start succeeding with a different state.
+	failingCallExecs  = 1000
+	failingCallWeight = 0.05
+	// Period of choice table rebuilds based on the call stats.
+	choiceTablePeriod = 10 * time.Minute
+)
+
+type callStat struct {
+	execs   uint64
+	success uint64
+	errnos  map[int]uint64
+}
+
+var (
+	callStatsMu sync.Mutex
+	callStats   = make(map[int]*callStat) // call ID -> stats
+	// newCallStats accumulates stats since the last poll for reporting to manager.
+	newCallStats = make(map[string]*CallStats)
+
+	choiceTableMu sync.RWMutex
+	choiceTable   *prog.ChoiceTable
+)
+
+// recordCallStats updates per-call errno statistics with the execution results.
+func recordCallStats(p *prog.Prog, info []ipc.CallInfo) {
+	callStatsMu.Lock()
+	defer callStatsMu.Unlock()
+	for i, inf := range info {
+		if inf.Errno == -1 || i >= len(p.Calls) {
+			continue // not executed
+		}
+		id := p.Calls[i].Meta.ID
+		stat := callStats[id]
+		if stat == nil {
+			stat = &callStat{errnos: make(map[int]uint64)}
+			callStats[id] = stat
+		}
+		stat.execs++
+		newStat := newCallStat(p.Calls[i].Meta.Name)
+		newStat.Execs++
+		if inf.Errno == 0 {
+			stat.success++
+			newStat.Success++
+		} else {
+			stat.errnos[inf.Errno]++
+			newStat.Errnos[inf.Errno]++
+		}
+	}
+}
+
+// recordCallSignal accounts new signal found by the call.
+func recordCallSignal(c *prog.Call, signal int) {
+	callStatsMu.Lock()
+	defer callStatsMu.Unlock()
+	newCallStat(c.Meta.Name).Signal += uint64(signal)
+}
+
+func newCallStat(name string) *CallStats {
+	stat := newCallStats[name]
+	if stat == nil {
+		stat = &CallStats{Errnos: make(map[int]uint64)}
+		newCallStats[name] = stat
+	}
+	return stat
+}
+
+// takeCallStats returns stats accumulated since the previous call.
+func takeCallStats() map[string]*CallStats {
+	callStatsMu.Lock()
+	defer callStatsMu.Unlock()
+	res := newCallStats
+	newCallStats = make(map[string]*CallStats)
+	return res
+}
+
+// failingCalls returns calls that have never succeeded so far (sorted by name).
+func failingCalls() []FailingCall {
+	callStatsMu.Lock()
+	defer callStatsMu.Unlock()
+	var res []FailingCall
+	for id, stat := range callStats {
+		if stat.success != 0 || stat.execs < failingCallExecs {
+			continue
+		}
+		fc := FailingCall{Name: sys.Calls[id].Name, Execs: stat.execs}
+		var max uint64
+		for errno, n := range stat.errnos {
+			if n > max || n == max && errno < fc.Errno {
+				max, fc.Errno = n, errno
+			}
+		}
+		res = append(res, fc)
+	}
+	sort.Sort(failingCallArray(res))
+	return res
+}
+
+// buildChoiceTable builds choice table from manager-provided priorities
+// with failing calls demoted and calls that reach fuzzing targets promoted.
+func buildChoiceTable(prios [][]float32, calls map[*sys.Call]bool, dict *prog.Dict,
+	failing []FailingCall, directed map[int]bool) *prog.ChoiceTable {
+	if len(failing) != 0 || len(directed) != 0 {
+		weights := make(map[int]float32)
+		for _, fc := range failing {
+			weights[sys.CallMap[fc.Name].ID] = failingCallWeight
+		}
+		for id := range directed {
+			weights[id] = directedCallWeight
+		}
+		prios1 := make([][]float32, len(prios))
+		for i := range prios {
+			prios1[i] = append([]float32{}, prios[i]...)
+		}
+		prog.ApplyCallWeights(prios1, weights)
+		prios = prios1
+	}
+	ct := prog.BuildChoiceTable(prios, calls)
+	if dict != nil {
+		ct.SetDict(dict)
+	}
+	return ct
+}
+
+func setChoiceTable(ct *prog.ChoiceTable) {
+	choiceTableMu.Lock()
+	choiceTable = ct
+	choiceTableMu.Unlock()
+}
+
+func getChoiceTable() *prog.ChoiceTable {
+	choiceTableMu.RLock()
+	defer choiceTableMu.RUnlock()
+	return choiceTable
+}
+
+func sameFailingCalls(a, b []FailingCall) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name {
+			return false
+		}
+	}
+	return true
+}
+
+func logFailingCalls(failing []FailingCall) {
+	Logf(0, "demoting %v always failing syscalls", len(failing))
+	for _, fc := range failing {
+		Logf(1, "failing syscall %v: %v execs, errno %v", fc.Name, fc.Execs, fc.Errno)
+	}
+}
+
+type failingCallArray []FailingCall
+
+func (a failingCallArray) Len() int           { return len(a) }
+func (a failingCallArray) Less(i, j int) bool { return a[i].Name < a[j].Name }
+func (a failingCallArray) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
@@ -0,0 +1,177 @@
+// Copyright 2017 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"net/rpc"
+	"reflect"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/google/syzkaller/pkg/log"
+	. "github.com/google/syzkaller/pkg/rpctype"
+)
+
+const (
+	// If connection to manager is lost (e.g. manager is restarted with new binaries),
+	// fuzzer tries to reconnect for reconnectTimeout and keeps all in-VM state meanwhile.
+	reconnectTimeout    = 10 * time.Minute
+	reconnectMaxBackoff = time.Minute
+	// Manager calls are retried (with reconnects in between) up to callAttempts times.
+	callAttempts = 3
+)
+
+var (
+	managerMu sync.Mutex
+	manager   *RpcClient
+	checkArgs *CheckArgs // sent again if manager was restarted and needs a VM check
+	// Config received on the first connect. Enabled syscalls, dictionary and cover filter
+	// are baked into the fuzzer and executor state, so if restarted manager sends a different
+	// config, fuzzer exits and manager restarts the VM.
+	connectConfig  *ConnectRes
+	reconnectPrios [][]float32 // new syscall priorities received on reconnect, protected by managerMu
+)
+
+// connectManager calls Manager.Connect on a transient connection (the reply can be very large).
+// Protocol version mismatch is fatal since retrying won't help.
+func connectManager(reconnect bool) (*ConnectRes, error) {
+	a := &ConnectArgs{
+		Name:      *flagName,
+		Version:   ProtocolVersion,
+		Reconnect: reconnect,
+	}
+	r := &ConnectRes{}
+	if err := RpcCall(*flagManager, *flagCompress, "Manager.Connect", a, r); err != nil {
+		if _, ok := err.(rpc.ServerError); ok {
+			Fatalf("manager rejected connection: %v", err)
+		}
+		return nil, err
+	}
+	if r.Version != ProtocolVersion {
+		Fatalf("manager uses protocol version %v, but fuzzer uses version %v"+
+			" (syz-fuzzer and syz-manager binaries are from different syzkaller revisions?)",
+			r.Version, ProtocolVersion)
+	}
+	return r, nil
+}
+
+func setConnectConfig(r *ConnectRes) {
+	connectConfig = &ConnectRes{
+		EnabledCalls: r.EnabledCalls,
+		Dict:         r.Dict,
+		CoverFilter:  r.CoverFilter,
+	}
+}
+
+func checkConnectConfig(r *ConnectRes) {
+	if r.EnabledCalls != connectConfig.EnabledCalls {
+		Fatalf("enabled syscalls changed on reconnect to manager")
+	}
+	if !bytes.Equal(r.Dict, connectConfig.Dict) {
+		Fatalf("dictionary changed on reconnect to manager")
+	}
+	if !reflect.DeepEqual(r.CoverFilter, connectConfig.CoverFilter) {
+		Fatalf("cover filter changed on reconnect to manager")
+	}
+}
+
+// takeReconnectPrios returns syscall priorities received on the last reconnect (if any).
+func takeReconnectPrios() [][]float32 {
+	managerMu.Lock()
+	defer managerMu.Unlock()
+	prios := reconnectPrios
+	reconnectPrios = nil
+	return prios
+}
+
+// handleConnectRes merges corpus, signal and candidates received from manager into the fuzzer state.
+func handleConnectRes(r *ConnectRes) {
+	setTargets(r.Targets)
+	for _, inp := range r.Inputs {
+		addInput(inp)
+	}
+	signalMu.Lock()
+	for _, s := range r.MaxSignal {
+		maxSignal[s] = struct{}{}
+	}
+	addFlakySignal(r.FlakySignal)
+	signalMu.Unlock()
+	addCandidates(r.Candidates)
+}
+
+// managerCall calls the manager method and reconnects to manager if the connection is broken
+// or manager does not know the fuzzer (was restarted). Other errors returned by manager
+// are deterministic (e.g. a bad input), so the call is dropped.
+func managerCall(method string, args, reply interface{}) {
+	for attempt := 1; ; attempt++ {
+		managerMu.Lock()
+		cli := manager
+		managerMu.Unlock()
+		err := cli.Call(method, args, reply)
+		if err == nil {
+			return
+		}
+		if serr, ok := err.(rpc.ServerError); ok && !strings.HasPrefix(string(serr), NotConnectedError) {
+			Logf(0, "%v failed: %v, dropping the call", method, err)
+			return
+		}
+		if attempt == callAttempts {
+			Fatalf("%v failed: %v", method, err)
+		}
+		Logf(0, "%v failed: %v, reconnecting to manager", method, err)
+		reconnectManager(cli)
+	}
+}
+
+// reconnectManager replaces broken connection to manager with a new one.
+func reconnectManager(broken *RpcClient) {
+	managerMu.Lock()
+	defer managerMu.Unlock()
+	if manager != broken {
+		return // somebody has already reconnected
+	}
+	broken.Close()
+	start := time.Now()
+	backoff := time.Second
+	for {
+		err := reconnectManager1()
+		if err == nil {
+			break
+		}
+		if time.Since(start) > reconnectTimeout {
+			Fatalf("failed to reconnect to manager: %v", err)
+		}
+		Logf(0, "failed to reconnect to manager: %v, retrying in %v", err, backoff)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > reconnectMaxBackoff {
+			backoff = reconnectMaxBackoff
+		}
+	}
+	Logf(0, "reconnected to manager")
+}
+
+func reconnectManager1() error {
+	r, err := connectManager(true)
+	if err != nil {
+		return err
+	}
+	checkConnectConfig(r)
+	if r.NeedCheck {
+		if err := RpcCall(*flagManager, *flagCompress, "Manager.Check", checkArgs, nil); err != nil {
+			return err
+		}
+	}
+	handleConnectRes(r)
+	reconnectPrios = r.Prios
+	debug.FreeOSMemory()
+	cli, err := NewRpcClient(*flagManager, *flagCompress)
+	if err != nil {
+		return err
+	}
+	manager = cli
+	return nil
+}
@@ -0,0 +1,101 @@
+// Copyright 2017 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+
+	. "github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/prog"
+)
+
+const (
+	// Probability to mutate a seed that covers fuzzing targets (if there are such seeds).
+	directedSeedProb = 0.5
+	// Syscalls that reach fuzzing targets are chosen directedCallWeight times more often.
+	directedCallWeight = 10
+)
+
+type directedSeed struct {
+	idx  int // index in corpus
+	dist int // distance to targets
+}
+
+var (
+	targetsMu     sync.RWMutex
+	targets       map[uint32]int // coverage PC -> distance to fuzzing targets
+	directedSeeds []directedSeed
+	directedIdx   = make(map[int]bool) // indices of directedSeeds in corpus
+	directedCalls = make(map[int]bool) // IDs of syscalls that reach fuzzing targets
+
+	statDirectedInputs uint64
+)
+
+func setTargets(t map[uint32]int) {
+	if len(t) == 0 {
+		return
+	}
+	Logf(0, "directing fuzzing to %v coverage PCs", len(t))
+	targetsMu.Lock()
+	targets = t
+	targetsMu.Unlock()
+}
+
+// recordDirected remembers corpus program idx if its cover reaches fuzzing targets.
+// call is the syscall that produced the cover.
+func recordDirected(idx int, call *prog.Call, cover []uint32) {
+	targetsMu.Lock()
+	defer targetsMu.Unlock()
+	if directedIdx[idx] {
+		return
+	}
+	dist, ok := 0, false
+	for _, pc := range cover {
+		if d, ok1 := targets[pc]; ok1 && (!ok || d < dist) {
+			dist, ok = d, true
+		}
+	}
+	if !ok {
+		return
+	}
+	atomic.AddUint64(&statDirectedInputs, 1)
+	directedSeeds = append(directedSeeds, directedSeed{idx, dist})
+	directedIdx[idx] = true
+	directedCalls[call.Meta.ID] = true
+}
+
+// chooseDirectedSeed returns index of a corpus program close to fuzzing targets
+// (closer programs are chosen more often), or false if a usual seed should be used.
+func chooseDirectedSeed(r *rand.Rand) (int, bool) {
+	targetsMu.RLock()
+	defer targetsMu.RUnlock()
+	if len(directedSeeds) == 0 || r.Float64() >= directedSeedProb {
+		return 0, false
+	}
+	total := 0.0
+	for _, s := range directedSeeds {
+		total += 1 / float64(1+s.dist)
+	}
+	x := r.Float64() * total
+	for _, s := range directedSeeds {
+		x -= 1 / float64(1+s.dist)
+		if x < 0 {
+			return s.idx, true
+		}
+	}
+	return directedSeeds[len(directedSeeds)-1].idx, true
+}
+
+// directedCallIDs returns IDs of syscalls that reach fuzzing targets.
+func directedCallIDs() map[int]bool {
+	targetsMu.RLock()
+	defer targetsMu.RUnlock()
+	res := make(map[int]bool)
+	for id := range directedCalls {
+		res[id] = true
+	}
+	return res
+}
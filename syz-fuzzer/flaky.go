@@ -0,0 +1,59 @@
+// Copyright 2017 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/google/syzkaller/sys"
+)
+
+// Signal that is not reproduced when an input is re-executed during triage
+// (e.g. edges in RCU callbacks or timers) is reported to manager as flaky.
+// Manager classifies it and sends back the flaky set, which does not count
+// as new signal anymore.
+var (
+	flakySignal    = make(map[uint32]struct{}) // protected by signalMu
+	newFlakySignal []uint32                    // reported since the last poll, protected by signalMu
+)
+
+// recordFlakySignal accounts signal of call that was not reproduced during triage.
+func recordFlakySignal(call *sys.Call, signal []uint32) {
+	if len(signal) == 0 {
+		return
+	}
+	signalMu.Lock()
+	for _, s := range signal {
+		if _, ok := flakySignal[s]; !ok {
+			newFlakySignal = append(newFlakySignal, s)
+		}
+	}
+	signalMu.Unlock()
+	callStatsMu.Lock()
+	newCallStat(call.Name).Flaky += uint64(len(signal))
+	callStatsMu.Unlock()
+}
+
+// addFlakySignal adds signal classified as flaky by manager.
+// It's also added to max signal so that it does not trigger triage.
+// Must be called with signalMu held.
+func addFlakySignal(signal []uint32) {
+	for _, s := range signal {
+		flakySignal[s] = struct{}{}
+		maxSignal[s] = struct{}{}
+	}
+}
+
+// removeFlaky returns signal without flaky elements.
+// Must be called with signalMu held.
+func removeFlaky(signal []uint32) []uint32 {
+	if len(flakySignal) == 0 {
+		return signal
+	}
+	res := signal[:0:0]
+	for _, s := range signal {
+		if _, ok := flakySignal[s]; !ok {
+			res = append(res, s)
+		}
+	}
+	return res
+}
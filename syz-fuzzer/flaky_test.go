@@ -0,0 +1,28 @@
+// Copyright 2017 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRemoveFlaky(t *testing.T) {
+	maxSignal = make(map[uint32]struct{})
+	flakySignal = make(map[uint32]struct{})
+	signal := []uint32{1, 2, 3, 4}
+	if res := removeFlaky(signal); !reflect.DeepEqual(res, signal) {
+		t.Fatalf("signal changed without flaky signal: %v", res)
+	}
+	addFlakySignal([]uint32{2, 4, 5})
+	if res, want := removeFlaky(signal), []uint32{1, 3}; !reflect.DeepEqual(res, want) {
+		t.Fatalf("got %v, want %v", res, want)
+	}
+	if want := []uint32{1, 2, 3, 4}; !reflect.DeepEqual(signal, want) {
+		t.Fatalf("input signal is modified: %v", signal)
+	}
+	if _, ok := maxSignal[5]; !ok {
+		t.Fatalf("flaky signal is not added to max signal")
+	}
+}
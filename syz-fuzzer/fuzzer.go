@@ -12,6 +12,7 @@ import (
 	_ "net/http/pprof"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime"
 	"runtime/debug"
 	"strconv"
@@ -33,13 +34,19 @@ import (
 )
 
 var (
-	flagName     = flag.String("name", "", "unique name for manager")
-	flagExecutor = flag.String("executor", "", "path to executor binary")
-	flagManager  = flag.String("manager", "", "manager rpc address")
-	flagProcs    = flag.Int("procs", 1, "number of parallel test processes")
-	flagLeak     = flag.Bool("leak", false, "detect memory leaks")
-	flagOutput   = flag.String("output", "stdout", "write programs to none/stdout/dmesg/file")
-	flagPprof    = flag.String("pprof", "", "address to serve pprof profiles")
+	flagName       = flag.String("name", "", "unique name for manager")
+	flagExecutor   = flag.String("executor", "", "path to executor binary")
+	flagManager    = flag.String("manager", "", "manager rpc address")
+	flagProcs      = flag.Int("procs", 1, "number of parallel test processes")
+	flagLeak       = flag.Bool("leak", false, "detect memory leaks")
+	flagOutput     = flag.String("output", "stdout", "write programs to none/stdout/dmesg/file")
+	flagPprof      = flag.String("pprof", "", "address to serve pprof profiles")
+	flagSeeds      = flag.String("seed_schedule", "uniform", "corpus seed selection policy: uniform/rare/power")
+	flagWork       = flag.String("work_schedule", "priority", "work scheduling policy: priority/weighted")
+	flagRatios     = flag.String("work_ratios", "", "work ratios, e.g. smash=0.5,generate=0.1")
+	flagCompress   = flag.Bool("rpc_compression", false, "compress RPC traffic with manager")
+	flagStandalone = flag.String("standalone", "", "fuzz without manager keeping corpus and logs in this dir")
+	flagSyncOutput = flag.Bool("sync_output", false, "fsync every program written with -output=file before executing it (slow)")
 )
 
 const (
@@ -59,8 +66,6 @@ type Candidate struct {
 }
 
 var (
-	manager *RpcClient
-
 	signalMu     sync.RWMutex
 	corpusSignal map[uint32]struct{}
 	maxSignal    map[uint32]struct{}
@@ -68,7 +73,9 @@ var (
 
 	corpusMu     sync.RWMutex
 	corpus       []*prog.Prog
-	corpusHashes map[hash.Sig]struct{}
+	corpusHashes map[hash.Sig]int // program hash -> index in corpus
+	seedSched    seedScheduler
+	workSched    workScheduler
 
 	triageMu        sync.RWMutex
 	triage          []Input
@@ -84,22 +91,55 @@ var (
 	statExecTriage    uint64
 	statExecMinimize  uint64
 	statExecSmash     uint64
+	statExecHintSeeds uint64
+	statExecHints     uint64
 	statNewInput      uint64
 
 	allTriaged            uint32
 	noCover               bool
 	faultInjectionEnabled bool
+	compsSupported        bool
 )
 
 func main() {
 	debug.SetGCPercent(50)
 	flag.Parse()
+	if *flagStandalone != "" {
+		if *flagManager != "" {
+			fmt.Fprintf(os.Stderr, "-standalone and -manager flags are mutually exclusive\n")
+			os.Exit(1)
+		}
+		if *flagName == "" {
+			*flagName = "standalone"
+		}
+		outputSet, syncSet := false, false
+		flag.Visit(func(f *flag.Flag) {
+			outputSet = outputSet || f.Name == "output"
+			syncSet = syncSet || f.Name == "sync_output"
+		})
+		if !outputSet {
+			*flagOutput = "file"
+		}
+		if !syncSet {
+			// The last programs must survive a crash of the local kernel.
+			*flagSyncOutput = true
+		}
+	}
 	switch *flagOutput {
 	case "none", "stdout", "dmesg", "file":
 	default:
 		fmt.Fprintf(os.Stderr, "-output flag must be one of none/stdout/dmesg/file\n")
 		os.Exit(1)
 	}
+	var err error
+	if seedSched, err = newSeedScheduler(*flagSeeds); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	if workSched, err = newWorkScheduler(*flagWork, *flagRatios); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
 	Logf(0, "fuzzer started")
 
 	go func() {
@@ -107,6 +147,10 @@ func main() {
 		c := make(chan os.Signal, 1)
 		signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
 		<-c
+		if *flagStandalone != "" {
+			// Graceful exit, the last programs did not crash the kernel.
+			os.RemoveAll(progsDir(*flagStandalone))
+		}
 		Logf(0, "SYZ-FUZZER: PREEMPTED")
 		os.Exit(1)
 	}()
@@ -123,37 +167,28 @@ func main() {
 	corpusSignal = make(map[uint32]struct{})
 	maxSignal = make(map[uint32]struct{})
 	newSignal = make(map[uint32]struct{})
-	corpusHashes = make(map[hash.Sig]struct{})
+	corpusHashes = make(map[hash.Sig]int)
 
+	if *flagStandalone != "" {
+		*flagManager = startStandalone(*flagStandalone)
+	}
 	Logf(0, "dialing manager at %v", *flagManager)
-	a := &ConnectArgs{*flagName}
-	r := &ConnectRes{}
-	if err := RpcCall(*flagManager, "Manager.Connect", a, r); err != nil {
-		panic(err)
+	r, err := connectManager(false)
+	if err != nil {
+		Fatalf("failed to connect to manager: %v", err)
 	}
 	calls := buildCallList(r.EnabledCalls)
-	ct := prog.BuildChoiceTable(r.Prios, calls)
-	for _, inp := range r.Inputs {
-		addInput(inp)
-	}
-	for _, s := range r.MaxSignal {
-		maxSignal[s] = struct{}{}
-	}
-	for _, candidate := range r.Candidates {
-		p, err := prog.Deserialize(candidate.Prog)
-		if err != nil {
+	prios := r.Prios
+	var dict *prog.Dict
+	if len(r.Dict) != 0 {
+		var err error
+		if dict, err = prog.ParseDict(r.Dict); err != nil {
 			panic(err)
 		}
-		if noCover {
-			corpusMu.Lock()
-			corpus = append(corpus, p)
-			corpusMu.Unlock()
-		} else {
-			triageMu.Lock()
-			candidates = append(candidates, Candidate{p, candidate.Minimized})
-			triageMu.Unlock()
-		}
 	}
+	setChoiceTable(buildChoiceTable(prios, calls, dict, nil, nil))
+	setConnectConfig(r)
+	handleConnectRes(r)
 
 	// This requires "fault-inject: support systematic fault injection" kernel commit.
 	if fd, err := syscall.Open("/proc/self/fail-nth", syscall.O_RDWR, 0); err == nil {
@@ -161,25 +196,25 @@ func main() {
 		faultInjectionEnabled = true
 	}
 
+	checkArgs = &CheckArgs{
+		Name:           *flagName,
+		UserNamespaces: osutil.IsExist("/proc/self/ns/user"),
+	}
+	if fd, err := syscall.Open("/sys/kernel/debug/kcov", syscall.O_RDWR, 0); err == nil {
+		syscall.Close(fd)
+		checkArgs.Kcov = true
+	}
+	if fd, err := syscall.Open("/sys/kernel/debug/kmemleak", syscall.O_RDWR, 0); err == nil {
+		syscall.Close(fd)
+		checkArgs.Leak = true
+	}
+	checkArgs.Fault = faultInjectionEnabled
+	for c := range calls {
+		checkArgs.Calls = append(checkArgs.Calls, c.Name)
+	}
 	if r.NeedCheck {
-		a := &CheckArgs{
-			Name:           *flagName,
-			UserNamespaces: osutil.IsExist("/proc/self/ns/user"),
-		}
-		if fd, err := syscall.Open("/sys/kernel/debug/kcov", syscall.O_RDWR, 0); err == nil {
-			syscall.Close(fd)
-			a.Kcov = true
-		}
-		if fd, err := syscall.Open("/sys/kernel/debug/kmemleak", syscall.O_RDWR, 0); err == nil {
-			syscall.Close(fd)
-			a.Leak = true
-		}
-		a.Fault = faultInjectionEnabled
-		for c := range calls {
-			a.Calls = append(a.Calls, c.Name)
-		}
-		if err := RpcCall(*flagManager, "Manager.Check", a, nil); err != nil {
-			panic(err)
+		if err := RpcCall(*flagManager, *flagCompress, "Manager.Check", checkArgs, nil); err != nil {
+			Fatalf("failed to send VM check to manager: %v", err)
 		}
 	}
 
@@ -187,7 +222,7 @@ func main() {
 	// So we do the call on a transient connection, free all memory and reconnect.
 	// The rest of rpc requests have bounded size.
 	debug.FreeOSMemory()
-	if conn, err := NewRpcClient(*flagManager); err != nil {
+	if conn, err := NewRpcClient(*flagManager, *flagCompress); err != nil {
 		panic(err)
 	} else {
 		manager = conn
@@ -208,7 +243,18 @@ func main() {
 	if faultInjectionEnabled {
 		config.Flags |= ipc.FlagEnableFault
 	}
+	if len(r.CoverFilter) != 0 {
+		config.CoverFilter = osutil.Abs("cover_filter")
+		if err := ipc.WriteCoverFilter(config.CoverFilter, r.CoverFilter); err != nil {
+			panic(err)
+		}
+		Logf(0, "restricting signal to %v PC ranges", len(r.CoverFilter))
+	}
 	noCover = config.Flags&ipc.FlagSignal == 0
+	if !noCover {
+		compsSupported = checkCompsSupported()
+		Logf(0, "comparison tracing supported: %v", compsSupported)
+	}
 	leakCallback := func() {
 		if atomic.LoadUint32(&allTriaged) != 0 {
 			// Scan for leaks once in a while (it is damn slow).
@@ -235,70 +281,45 @@ func main() {
 			rnd := rand.New(rs)
 
 			for i := 0; ; i++ {
-				triageMu.RLock()
-				if len(triageCandidate) != 0 || len(candidates) != 0 || len(triage) != 0 || len(smashQueue) != 0 {
-					triageMu.RUnlock()
-					triageMu.Lock()
-					if len(triageCandidate) != 0 {
-						last := len(triageCandidate) - 1
-						inp := triageCandidate[last]
-						triageCandidate = triageCandidate[:last]
-						triageMu.Unlock()
-						Logf(1, "triaging candidate: %s", inp.p)
-						triageInput(pid, env, inp)
-						continue
-					} else if len(candidates) != 0 {
-						last := len(candidates) - 1
-						candidate := candidates[last]
-						candidates = candidates[:last]
-						wakePoll := len(candidates) < *flagProcs
-						triageMu.Unlock()
-						if wakePoll {
-							select {
-							case needPoll <- struct{}{}:
-							default:
-							}
+				ct := getChoiceTable()
+				w := nextWork(rnd)
+				switch w.kind {
+				case workTriageCandidate:
+					Logf(1, "triaging candidate: %s", w.inp.p)
+					triageInput(pid, env, w.inp)
+				case workCandidate:
+					if w.wakePoll {
+						select {
+						case needPoll <- struct{}{}:
+						default:
 						}
-						Logf(1, "executing candidate: %s", candidate.p)
-						execute(pid, env, candidate.p, false, candidate.minimized, true, &statExecCandidate)
-						continue
-					} else if len(triage) != 0 {
-						last := len(triage) - 1
-						inp := triage[last]
-						triage = triage[:last]
-						triageMu.Unlock()
-						Logf(1, "triaging : %s", inp.p)
-						triageInput(pid, env, inp)
-						continue
-					} else if len(smashQueue) != 0 {
-						last := len(smashQueue) - 1
-						inp := smashQueue[last]
-						smashQueue = smashQueue[:last]
-						triageMu.Unlock()
-						Logf(1, "%v: smashing call %v in program: %v", pid, inp.call, inp.p.String())
-						smashInput(pid, env, ct, rs, inp)
-						continue
-					} else {
-						triageMu.Unlock()
 					}
-				} else {
-					triageMu.RUnlock()
-				}
-
-				corpusMu.RLock()
-				if len(corpus) == 0 || i%100 == 0 {
-					// Generate a new prog.
-					corpusMu.RUnlock()
+					Logf(1, "executing candidate: %s", w.candidate.p)
+					execute(pid, env, w.candidate.p, false, w.candidate.minimized, true, &statExecCandidate)
+				case workTriage:
+					Logf(1, "triaging : %s", w.inp.p)
+					triageInput(pid, env, w.inp)
+				case workSmash:
+					Logf(1, "%v: smashing call %v in program: %v", pid, w.inp.call, w.inp.p.String())
+					smashInput(pid, env, ct, rs, w.inp)
+				case workGenerate:
 					p := prog.Generate(rnd, programLength, ct)
 					Logf(1, "#%v: generated: %s", i, p)
 					execute(pid, env, p, false, false, false, &statExecGen)
-				} else {
+				case workFuzz:
 					// Mutate an existing prog.
-					p := corpus[rnd.Intn(len(corpus))].Clone()
+					corpusMu.RLock()
+					seed, ok := chooseDirectedSeed(rnd)
+					if !ok {
+						seed = seedSched.chooseSeed(rnd, len(corpus))
+					}
+					p := corpus[seed].Clone()
 					corpusMu.RUnlock()
 					p.Mutate(rs, programLength, ct, corpus)
-					Logf(1, "#%v: mutated: %s", i, p)
-					execute(pid, env, p, false, false, false, &statExecFuzz)
+					Logf(1, "#%v: mutated seed #%v: %s", i, seed, p)
+					_, found := execute(pid, env, p, false, false, false, &statExecFuzz)
+					seedSched.seedResult(seed, found)
+					seedStat.record(seed, found)
 				}
 			}
 		}()
@@ -307,6 +328,9 @@ func main() {
 	var execTotal uint64
 	var lastPoll time.Time
 	var lastPrint time.Time
+	var failing []FailingCall
+	var directed map[int]bool
+	lastChoiceTable := time.Now()
 	ticker := time.NewTicker(3 * time.Second).C
 	for {
 		poll := false
@@ -320,6 +344,30 @@ func main() {
 			Logf(0, "alive, executed %v", execTotal)
 			lastPrint = time.Now()
 		}
+		if time.Since(lastChoiceTable) > choiceTablePeriod {
+			lastChoiceTable = time.Now()
+			failing1 := failingCalls()
+			directed1 := directedCallIDs()
+			changed := false
+			if !sameFailingCalls(failing, failing1) {
+				logFailingCalls(failing1)
+				changed = true
+			}
+			if len(directed) != len(directed1) {
+				Logf(0, "promoting %v syscalls that reach fuzzing targets", len(directed1))
+				changed = true
+			}
+			if prios1 := takeReconnectPrios(); prios1 != nil {
+				prios = prios1
+				changed = true
+			}
+			if changed {
+				setChoiceTable(buildChoiceTable(prios, calls, dict, failing1, directed1))
+			}
+			failing = failing1
+			directed = directed1
+			seedStat.logTop(10)
+		}
 		if poll || time.Since(lastPoll) > 10*time.Second {
 			triageMu.RLock()
 			if len(candidates) > *flagProcs {
@@ -329,8 +377,10 @@ func main() {
 			triageMu.RUnlock()
 
 			a := &PollArgs{
-				Name:  *flagName,
-				Stats: make(map[string]uint64),
+				Name:         *flagName,
+				Stats:        make(map[string]uint64),
+				FailingCalls: failing,
+				CallStats:    takeCallStats(),
 			}
 			signalMu.Lock()
 			a.MaxSignal = make([]uint32, 0, len(newSignal))
@@ -338,6 +388,8 @@ func main() {
 				a.MaxSignal = append(a.MaxSignal, s)
 			}
 			newSignal = make(map[uint32]struct{})
+			a.FlakySignal = newFlakySignal
+			newFlakySignal = nil
 			signalMu.Unlock()
 			for _, env := range envs {
 				a.Stats["exec total"] += atomic.SwapUint64(&env.StatExecs, 0)
@@ -361,36 +413,33 @@ func main() {
 			execSmash := atomic.SwapUint64(&statExecSmash, 0)
 			a.Stats["exec smash"] = execSmash
 			execTotal += execSmash
+			execHintSeeds := atomic.SwapUint64(&statExecHintSeeds, 0)
+			a.Stats["exec hint seeds"] = execHintSeeds
+			execTotal += execHintSeeds
+			execHints := atomic.SwapUint64(&statExecHints, 0)
+			a.Stats["exec hints"] = execHints
+			execTotal += execHints
 			a.Stats["fuzzer new inputs"] = atomic.SwapUint64(&statNewInput, 0)
-			r := &PollRes{}
-			if err := manager.Call("Manager.Poll", a, r); err != nil {
-				panic(err)
+			a.Stats["fuzzer directed inputs"] = atomic.SwapUint64(&statDirectedInputs, 0)
+			a.Stats["fuzz new signal"], a.Stats["fuzz productive seeds"] = seedStat.take()
+			for kind := range statWork {
+				a.Stats["work "+workKindNames[kind]] = atomic.SwapUint64(&statWork[kind], 0)
 			}
-			if len(r.MaxSignal) != 0 {
+			r := &PollRes{}
+			managerCall("Manager.Poll", a, r)
+			if len(r.MaxSignal) != 0 || len(r.FlakySignal) != 0 {
 				signalMu.Lock()
 				for _, s := range r.MaxSignal {
 					maxSignal[s] = struct{}{}
 				}
+				addFlakySignal(r.FlakySignal)
 				signalMu.Unlock()
 			}
+			setTargets(r.Targets)
 			for _, inp := range r.NewInputs {
 				addInput(inp)
 			}
-			for _, candidate := range r.Candidates {
-				p, err := prog.Deserialize(candidate.Prog)
-				if err != nil {
-					panic(err)
-				}
-				if noCover {
-					corpusMu.Lock()
-					corpus = append(corpus, p)
-					corpusMu.Unlock()
-				} else {
-					triageMu.Lock()
-					candidates = append(candidates, Candidate{p, candidate.Minimized})
-					triageMu.Unlock()
-				}
-			}
+			addCandidates(r.Candidates)
 			if len(r.Candidates) == 0 && atomic.LoadUint32(&allTriaged) == 0 {
 				if *flagLeak {
 					kmemleakScan(false)
@@ -441,6 +490,24 @@ func buildCallList(enabledCalls string) map[*sys.Call]bool {
 	return calls
 }
 
+func addCandidates(cands []RpcCandidate) {
+	for _, candidate := range cands {
+		p, err := prog.Deserialize(candidate.Prog)
+		if err != nil {
+			panic(err)
+		}
+		if noCover {
+			corpusMu.Lock()
+			appendCorpus(p, nil)
+			corpusMu.Unlock()
+		} else {
+			triageMu.Lock()
+			candidates = append(candidates, Candidate{p, candidate.Minimized})
+			triageMu.Unlock()
+		}
+	}
+}
+
 func addInput(inp RpcInput) {
 	corpusMu.Lock()
 	defer corpusMu.Unlock()
@@ -457,10 +524,14 @@ func addInput(inp RpcInput) {
 	if inp.CallIndex < 0 || inp.CallIndex >= len(p.Calls) {
 		Fatalf("bad call index %v, calls %v, program:\n%s", inp.CallIndex, len(p.Calls), inp.Prog)
 	}
-	sig := hash.Hash(inp.Prog)
-	if _, ok := corpusHashes[sig]; !ok {
-		corpus = append(corpus, p)
-		corpusHashes[sig] = struct{}{}
+	sig := p.SemanticHash()
+	if idx, ok := corpusHashes[sig]; !ok {
+		idx = appendCorpus(p, inp.Signal)
+		corpusHashes[sig] = idx
+		recordDirected(idx, p.Calls[inp.CallIndex], inp.Cover)
+	} else if len(inp.Cover) != 0 {
+		// Manager re-sends inputs that reach fuzzing targets once targets are resolved.
+		recordDirected(idx, p.Calls[inp.CallIndex], inp.Cover)
 	}
 	if diff := cover.SignalDiff(maxSignal, inp.Signal); len(diff) != 0 {
 		cover.SignalAdd(corpusSignal, diff)
@@ -468,10 +539,21 @@ func addInput(inp RpcInput) {
 	}
 }
 
+// appendCorpus adds p to corpus and registers it with the seed scheduler.
+// Returns index of p in corpus. Must be called with corpusMu held.
+func appendCorpus(p *prog.Prog, signal []uint32) int {
+	corpus = append(corpus, p)
+	seedSched.addSeed(signal)
+	return len(corpus) - 1
+}
+
 func smashInput(pid int, env *ipc.Env, ct *prog.ChoiceTable, rs rand.Source, inp Input) {
 	if faultInjectionEnabled {
 		failCall(pid, env, inp.p, inp.call)
 	}
+	if compsSupported {
+		executeHintSeed(pid, env, inp.p, inp.call)
+	}
 	for i := 0; i < 100; i++ {
 		p := inp.p.Clone()
 		p.Mutate(rs, programLength, ct, corpus)
@@ -495,13 +577,30 @@ func failCall(pid int, env *ipc.Env, p *prog.Prog, call int) {
 	}
 }
 
+func executeHintSeed(pid int, env *ipc.Env, p *prog.Prog, call int) {
+	Logf(1, "%v: collecting comparisons for call %v in program: %v", pid, call, p.String())
+	// First execute the original program to dump comparisons from KCOV.
+	opts := &ipc.ExecOpts{Flags: ipc.FlagCollectComps}
+	info := execute1(pid, env, opts, p, &statExecHintSeeds)
+	if info == nil || len(info) <= call {
+		return
+	}
+	// Then mutate the initial program for every match between
+	// a syscall argument and a comparison operand.
+	// Execute each of such mutants to check if it gives new coverage.
+	p.MutateWithHints(call, info[call].Comps, func(p *prog.Prog) {
+		Logf(1, "%v: executing program mutated with hints: %v", pid, p.String())
+		execute(pid, env, p, false, false, false, &statExecHints)
+	})
+}
+
 func triageInput(pid int, env *ipc.Env, inp Input) {
 	if noCover {
 		panic("should not be called when coverage is disabled")
 	}
 
 	signalMu.RLock()
-	newSignal := cover.SignalDiff(corpusSignal, inp.signal)
+	newSignal := removeFlaky(cover.SignalDiff(corpusSignal, inp.signal))
 	signalMu.RUnlock()
 	if len(newSignal) == 0 {
 		return
@@ -510,7 +609,7 @@ func triageInput(pid int, env *ipc.Env, inp Input) {
 
 	call := inp.p.Calls[inp.call].Meta
 	data := inp.p.Serialize()
-	sig := hash.Hash(data)
+	sig := inp.p.SemanticHash()
 
 	Logf(3, "triaging input for %v (new signal=%v):\n%s", call.CallName, len(newSignal), data)
 	var inputCover cover.Cover
@@ -529,6 +628,8 @@ func triageInput(pid int, env *ipc.Env, inp Input) {
 		}
 	} else {
 		// We need to compute input coverage and non-flaky signal for minimization.
+		var flaky cover.Cover
+		defer func() { recordFlakySignal(call, flaky) }()
 		notexecuted := false
 		for i := 0; i < 3; i++ {
 			info := execute1(pid, env, opts, inp.p, &statExecTriage)
@@ -541,7 +642,9 @@ func triageInput(pid int, env *ipc.Env, inp Input) {
 				continue
 			}
 			inf := info[inp.call]
+			prevSignal := newSignal
 			newSignal = cover.Intersection(newSignal, cover.Canonicalize(inf.Signal))
+			flaky = cover.Union(flaky, cover.Difference(prevSignal, newSignal))
 			if len(newSignal) == 0 {
 				return
 			}
@@ -553,7 +656,7 @@ func triageInput(pid int, env *ipc.Env, inp Input) {
 		}
 
 		inp.p, inp.call = prog.Minimize(inp.p, inp.call, func(p1 *prog.Prog, call1 int) bool {
-			info := execute(pid, env, p1, false, false, false, &statExecMinimize)
+			info, _ := execute(pid, env, p1, false, false, false, &statExecMinimize)
 			if len(info) == 0 || len(info[call1].Signal) == 0 {
 				return false // The call was not executed.
 			}
@@ -580,9 +683,7 @@ func triageInput(pid int, env *ipc.Env, inp Input) {
 			Cover:     []uint32(inputCover),
 		},
 	}
-	if err := manager.Call("Manager.NewInput", a, nil); err != nil {
-		panic(err)
-	}
+	managerCall("Manager.NewInput", a, nil)
 
 	signalMu.Lock()
 	cover.SignalAdd(corpusSignal, inp.signal)
@@ -590,8 +691,9 @@ func triageInput(pid int, env *ipc.Env, inp Input) {
 
 	corpusMu.Lock()
 	if _, ok := corpusHashes[sig]; !ok {
-		corpus = append(corpus, inp.p)
-		corpusHashes[sig] = struct{}{}
+		idx := appendCorpus(inp.p, cover.Canonicalize(inp.signal))
+		corpusHashes[sig] = idx
+		recordDirected(idx, inp.p.Calls[inp.call], inputCover)
 	}
 	corpusMu.Unlock()
 
@@ -602,12 +704,15 @@ func triageInput(pid int, env *ipc.Env, inp Input) {
 	}
 }
 
-func execute(pid int, env *ipc.Env, p *prog.Prog, needCover, minimized, candidate bool, stat *uint64) []ipc.CallInfo {
+// execute executes p and queues calls that gave new signal for triage.
+// It returns execution results and the amount of new signal.
+func execute(pid int, env *ipc.Env, p *prog.Prog, needCover, minimized, candidate bool, stat *uint64) ([]ipc.CallInfo, int) {
 	opts := &ipc.ExecOpts{}
 	if needCover {
 		opts.Flags |= ipc.FlagCollectCover
 	}
 	info := execute1(pid, env, opts, p, stat)
+	found := 0
 	signalMu.RLock()
 	defer signalMu.RUnlock()
 
@@ -616,6 +721,8 @@ func execute(pid int, env *ipc.Env, p *prog.Prog, needCover, minimized, candidat
 			continue
 		}
 		diff := cover.SignalDiff(maxSignal, inf.Signal)
+		recordCallSignal(p.Calls[i], len(diff))
+		found += len(diff)
 
 		signalMu.RUnlock()
 		signalMu.Lock()
@@ -638,7 +745,7 @@ func execute(pid int, env *ipc.Env, p *prog.Prog, needCover, minimized, candidat
 		}
 		triageMu.Unlock()
 	}
-	return info
+	return info, found
 }
 
 var logMu sync.Mutex
@@ -684,12 +791,19 @@ func execute1(pid int, env *ipc.Env, opts *ipc.ExecOpts, p *prog.Prog, stat *uin
 			syscall.Close(fd)
 		}
 	case "file":
-		f, err := os.Create(fmt.Sprintf("%v-%v.prog", *flagName, pid))
+		file := fmt.Sprintf("%v-%v.prog", *flagName, pid)
+		if *flagStandalone != "" {
+			file = filepath.Join(progsDir(*flagStandalone), file)
+		}
+		f, err := os.Create(file)
 		if err == nil {
 			if strOpts != "" {
 				fmt.Fprintf(f, "#%v\n", strOpts)
 			}
 			f.Write(p.Serialize())
+			if *flagSyncOutput {
+				f.Sync()
+			}
 			f.Close()
 		}
 	}
@@ -715,6 +829,9 @@ retry:
 		goto retry
 	}
 	Logf(2, "result failed=%v hanged=%v: %v\n", failed, hanged, string(output))
+	if opts.Flags&ipc.FlagInjectFault == 0 {
+		recordCallStats(p, info)
+	}
 	return info
 }
 
@@ -790,3 +907,42 @@ func kmemleakScan(report bool) {
 		panic(err)
 	}
 }
+
+// checkCompsSupported checks if the kernel supports KCOV_TRACE_CMP mode.
+// This requires "kcov: support comparison operands collection" kernel commit.
+func checkCompsSupported() bool {
+	// Note: this is linux-specific and these constants are the same for
+	// x86_64 and arm64, but KCOV_INIT_TRACE differs on ppc64le.
+	const (
+		kcovInitTrace = 0x80086301
+		kcovEnable    = 0x6364
+		kcovDisable   = 0x6365
+		kcovTraceCmp  = 1
+		coverSize     = 64 << 10
+	)
+	initTrace := uintptr(kcovInitTrace)
+	if runtime.GOARCH == "ppc64le" {
+		initTrace = 0x40086301
+	}
+	fd, err := syscall.Open("/sys/kernel/debug/kcov", syscall.O_RDWR, 0)
+	if err != nil {
+		return false
+	}
+	defer syscall.Close(fd)
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), initTrace, coverSize); errno != 0 {
+		return false
+	}
+	mem, err := syscall.Mmap(fd, 0, coverSize*8, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return false
+	}
+	defer syscall.Munmap(mem)
+	// KCOV is enabled for the current thread, so make sure we disable it on the same thread.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), kcovEnable, kcovTraceCmp); errno != 0 {
+		return false
+	}
+	syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), kcovDisable, 0)
+	return true
+}
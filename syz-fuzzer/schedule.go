@@ -0,0 +1,290 @@
+// Copyright 2017 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	. "github.com/google/syzkaller/pkg/log"
+)
+
+const (
+	// Seed weights are recomputed at most once per seedWeightsPeriod
+	// (when corpus or seed feedback changes), seeds added in between are chosen uniformly.
+	seedWeightsPeriod = 10 * time.Second
+	// Productivity of seeds under power schedule halves every powerDecayPeriod,
+	// so that recently productive seeds are preferred.
+	powerDecayPeriod = 10 * time.Minute
+)
+
+// seedScheduler selects corpus programs for mutation.
+// Seeds are identified by their index in corpus.
+type seedScheduler interface {
+	// addSeed is called when a program is appended to corpus,
+	// signal is the input signal (nil if unknown).
+	addSeed(signal []uint32)
+	// chooseSeed returns index of the next seed to mutate, n is the current corpus size.
+	chooseSeed(r *rand.Rand, n int) int
+	// seedResult is called after execution of a mutant of seed idx
+	// with the amount of new signal the mutant gave.
+	seedResult(idx, newSignal int)
+}
+
+func newSeedScheduler(name string) (seedScheduler, error) {
+	switch name {
+	case "uniform":
+		return &uniformScheduler{}, nil
+	case "rare":
+		s := &rareScheduler{seeds: make(map[uint32][]int)}
+		s.weight = s.seedWeight
+		return s, nil
+	case "power":
+		s := &powerScheduler{lastDecay: time.Now()}
+		s.weight = s.seedWeight
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unknown seed schedule '%v', want one of uniform/rare/power", name)
+	}
+}
+
+// seedStats is productivity of seeds collected regardless of the policy.
+type seedStats struct {
+	mu         sync.Mutex
+	found      map[int]uint64 // seed index -> number of mutants with new signal
+	newSignal  uint64         // new signal found by mutants since the last poll
+	productive uint64         // number of seeds that became productive since the last poll
+}
+
+var seedStat = &seedStats{found: make(map[int]uint64)}
+
+func (st *seedStats) record(idx, newSignal int) {
+	if newSignal == 0 {
+		return
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.found[idx] == 0 {
+		st.productive++
+	}
+	st.found[idx]++
+	st.newSignal += uint64(newSignal)
+}
+
+// take returns amount of new signal and number of new productive seeds since the previous call.
+func (st *seedStats) take() (newSignal, productive uint64) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	newSignal, productive = st.newSignal, st.productive
+	st.newSignal, st.productive = 0, 0
+	return
+}
+
+// logTop prints n most productive seeds.
+func (st *seedStats) logTop(n int) {
+	st.mu.Lock()
+	var seeds []productiveSeed
+	for idx, found := range st.found {
+		seeds = append(seeds, productiveSeed{idx, found})
+	}
+	st.mu.Unlock()
+	Logf(1, "%v productive seeds", len(seeds))
+	sort.Sort(productiveSeedArray(seeds))
+	if len(seeds) > n {
+		seeds = seeds[:n]
+	}
+	corpusMu.RLock()
+	defer corpusMu.RUnlock()
+	for _, s := range seeds {
+		Logf(1, "seed #%v produced %v inputs with new signal:\n%s", s.idx, s.found, corpus[s.idx])
+	}
+}
+
+type productiveSeed struct {
+	idx   int
+	found uint64
+}
+
+type productiveSeedArray []productiveSeed
+
+func (a productiveSeedArray) Len() int { return len(a) }
+func (a productiveSeedArray) Less(i, j int) bool {
+	if a[i].found != a[j].found {
+		return a[i].found > a[j].found
+	}
+	return a[i].idx < a[j].idx
+}
+func (a productiveSeedArray) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+
+// uniformScheduler chooses all seeds with equal probability.
+type uniformScheduler struct{}
+
+func (s *uniformScheduler) addSeed(signal []uint32) {}
+
+func (s *uniformScheduler) chooseSeed(r *rand.Rand, n int) int {
+	return r.Intn(n)
+}
+
+func (s *uniformScheduler) seedResult(idx, newSignal int) {}
+
+// weightedChooser chooses seeds proportionally to weights.
+// Prefix sums of weights are rebuilt periodically rather than on every weight change.
+type weightedChooser struct {
+	mu         sync.Mutex
+	prefix     []float64 // prefix sums of seed weights
+	lastUpdate time.Time
+	dirty      bool                  // weights has changed since the last update
+	weight     func(idx int) float64 // called with mu held
+}
+
+func (w *weightedChooser) choose(r *rand.Rand, n int) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if (w.dirty || len(w.prefix) != n) && (len(w.prefix) == 0 || time.Since(w.lastUpdate) > seedWeightsPeriod) {
+		w.update(n)
+	}
+	k := len(w.prefix)
+	if k > n {
+		k = n
+	}
+	if k == 0 || k < n && r.Intn(n) >= k {
+		// Seeds without computed weights yet.
+		return k + r.Intn(n-k)
+	}
+	total := w.prefix[k-1]
+	if total <= 0 {
+		return r.Intn(k)
+	}
+	idx := sort.SearchFloat64s(w.prefix[:k], r.Float64()*total)
+	if idx >= k {
+		idx = k - 1
+	}
+	return idx
+}
+
+func (w *weightedChooser) update(n int) {
+	w.lastUpdate = time.Now()
+	w.dirty = false
+	if cap(w.prefix) < n {
+		w.prefix = make([]float64, n, 2*n)
+	}
+	w.prefix = w.prefix[:n]
+	total := 0.0
+	for i := 0; i < n; i++ {
+		total += w.weight(i)
+		w.prefix[i] = total
+	}
+}
+
+// rareScheduler favors seeds that cover rare signal:
+// weight of a seed is sum of inverse frequencies of its signal elements in corpus.
+// Weights are maintained incrementally: a new seed changes only weights
+// of the seeds that share signal elements with it.
+type rareScheduler struct {
+	weightedChooser
+	weights []float64        // weight of every seed
+	seeds   map[uint32][]int // signal element -> seeds that cover it
+}
+
+func (s *rareScheduler) addSeed(signal []uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idx := len(s.weights)
+	if len(signal) == 0 {
+		s.weights = append(s.weights, 1)
+		return
+	}
+	s.weights = append(s.weights, 0)
+	for _, sig := range signal {
+		covered := s.seeds[sig]
+		// Contribution of sig to weights of the seeds that cover it drops from 1/f to 1/(f+1).
+		if f := float64(len(covered)); f != 0 {
+			delta := 1/(f+1) - 1/f
+			for _, i := range covered {
+				s.weights[i] += delta
+			}
+		}
+		covered = append(covered, idx)
+		s.seeds[sig] = covered
+		s.weights[idx] += 1 / float64(len(covered))
+	}
+	s.dirty = true
+}
+
+func (s *rareScheduler) chooseSeed(r *rand.Rand, n int) int {
+	return s.choose(r, n)
+}
+
+func (s *rareScheduler) seedResult(idx, newSignal int) {}
+
+func (s *rareScheduler) seedWeight(idx int) float64 {
+	if idx >= len(s.weights) {
+		return 1
+	}
+	return s.weights[idx]
+}
+
+// powerScheduler favors recently productive seeds (seeds whose mutants gave new signal)
+// and penalizes seeds that were mutated a lot without results.
+type powerScheduler struct {
+	weightedChooser
+	seeds     []powerSeed
+	lastDecay time.Time
+}
+
+type powerSeed struct {
+	chosen uint64
+	found  float64 // decayed number of productive mutants
+}
+
+func (s *powerScheduler) addSeed(signal []uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seeds = append(s.seeds, powerSeed{})
+}
+
+func (s *powerScheduler) chooseSeed(r *rand.Rand, n int) int {
+	s.mu.Lock()
+	if time.Since(s.lastDecay) > powerDecayPeriod {
+		s.lastDecay = time.Now()
+		for i := range s.seeds {
+			s.seeds[i].found /= 2
+		}
+		s.dirty = true
+	}
+	s.mu.Unlock()
+	idx := s.choose(r, n)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if idx < len(s.seeds) {
+		// Does not mark weights dirty: chosen counts change on every call,
+		// they are accounted on the next update caused by feedback or new seeds.
+		s.seeds[idx].chosen++
+	}
+	return idx
+}
+
+func (s *powerScheduler) seedResult(idx, newSignal int) {
+	if newSignal == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if idx < len(s.seeds) {
+		s.seeds[idx].found++
+		s.dirty = true
+	}
+}
+
+func (s *powerScheduler) seedWeight(idx int) float64 {
+	if idx >= len(s.seeds) {
+		return 1
+	}
+	seed := &s.seeds[idx]
+	return (1 + 10*seed.found) / math.Sqrt(1+float64(seed.chosen))
+}
@@ -0,0 +1,83 @@
+// Copyright 2017 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestPowerScheduleFeedback(t *testing.T) {
+	const (
+		seeds      = 10
+		productive = 3
+		iters      = 10000
+	)
+	s, err := newSeedScheduler("power")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := rand.New(rand.NewSource(0))
+	for i := 0; i < seeds; i++ {
+		s.addSeed(nil)
+	}
+	count := func() int {
+		n := 0
+		for i := 0; i < iters; i++ {
+			if s.chooseSeed(r, seeds) == productive {
+				n++
+			}
+		}
+		return n
+	}
+	before := count()
+	// Corpus does not grow, but one seed becomes productive.
+	for i := 0; i < 10; i++ {
+		s.seedResult(productive, 1)
+	}
+	s.(*powerScheduler).lastUpdate = time.Now().Add(-2 * seedWeightsPeriod)
+	after := count()
+	t.Logf("productive seed chosen %v times before and %v times after", before, after)
+	if after < 2*before {
+		t.Fatalf("productive seed is not preferred: chosen %v times before and %v times after",
+			before, after)
+	}
+}
+
+func TestRareScheduleWeights(t *testing.T) {
+	s, err := newSeedScheduler("rare")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := rand.New(rand.NewSource(0))
+	var signals [][]uint32
+	for i := 0; i < 100; i++ {
+		var signal []uint32
+		for j := r.Intn(10); j > 0; j-- {
+			signal = append(signal, uint32(r.Intn(20)))
+		}
+		signals = append(signals, signal)
+		s.addSeed(signal)
+	}
+	freq := make(map[uint32]int)
+	for _, signal := range signals {
+		for _, sig := range signal {
+			freq[sig]++
+		}
+	}
+	for idx, signal := range signals {
+		want := 1.0
+		if len(signal) != 0 {
+			want = 0
+			for _, sig := range signal {
+				want += 1 / float64(freq[sig])
+			}
+		}
+		if got := s.(*rareScheduler).seedWeight(idx); math.Abs(got-want) > 1e-9 {
+			t.Fatalf("seed %v: weight %v, want %v", idx, got, want)
+		}
+	}
+}
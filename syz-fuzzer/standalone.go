@@ -0,0 +1,279 @@
+// Copyright 2017 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/syzkaller/pkg/cover"
+	"github.com/google/syzkaller/pkg/db"
+	. "github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/pkg/osutil"
+	. "github.com/google/syzkaller/pkg/rpctype"
+	"github.com/google/syzkaller/prog"
+)
+
+// In standalone mode (-standalone=workdir) fuzzer does not need syz-manager:
+// it serves the manager RPC interface itself on a local port. Corpus is kept
+// in workdir/corpus.db, the last program executed by every process is written
+// to workdir/progs (these are the programs to look at if the kernel crashes)
+// and stats are periodically printed to the log.
+// Kernel crash is detected on the next start by a changed boot ID.
+const standaloneStatsPeriod = time.Minute
+
+// Manager implements manager RPC interface for standalone mode.
+type Manager struct {
+	workdir   string
+	startTime time.Time
+
+	mu           sync.Mutex
+	corpusDB     *db.DB
+	corpus       map[string]RpcInput
+	corpusSignal map[uint32]struct{}
+	maxSignal    map[uint32]struct{}
+	flakySignal  map[uint32]struct{}
+	newFlaky     []uint32
+	candidates   []RpcCandidate
+	prios        [][]float32
+	stats        map[string]uint64
+	checked      bool
+}
+
+// startStandalone starts local manager in workdir and returns its RPC address.
+func startStandalone(workdir string) string {
+	if err := osutil.MkdirAll(workdir); err != nil {
+		Fatalf("failed to create workdir: %v", err)
+	}
+	saveCrashPrograms(workdir)
+	if err := osutil.MkdirAll(progsDir(workdir)); err != nil {
+		Fatalf("failed to create progs dir: %v", err)
+	}
+	if err := osutil.WriteFile(bootIDFile(workdir), []byte(bootID())); err != nil {
+		Fatalf("failed to write boot id: %v", err)
+	}
+	mgr := &Manager{
+		workdir:      workdir,
+		startTime:    time.Now(),
+		corpus:       make(map[string]RpcInput),
+		corpusSignal: make(map[uint32]struct{}),
+		maxSignal:    make(map[uint32]struct{}),
+		flakySignal:  make(map[uint32]struct{}),
+		stats:        make(map[string]uint64),
+	}
+	var err error
+	mgr.corpusDB, err = db.Open(filepath.Join(workdir, "corpus.db"))
+	if err != nil {
+		Fatalf("failed to open corpus database: %v", err)
+	}
+	var corpus []*prog.Prog
+	repaired := make(map[string][]byte)
+	for key, rec := range mgr.corpusDB.Records {
+		p, fixes, err := prog.DeserializeRepair(rec.Val)
+		if err != nil {
+			Logf(0, "deleting broken program: %v", err)
+			mgr.corpusDB.Delete(key)
+			continue
+		}
+		if len(fixes) != 0 {
+			Logf(1, "repaired program:\n%s\nchanges:\n%v", rec.Val, strings.Join(fixes, "\n"))
+			rec.Val = p.Serialize()
+			sig := p.SemanticHash()
+			newKey := sig.String()
+			if _, exists := mgr.corpusDB.Records[newKey]; exists || repaired[newKey] != nil {
+				// Don't overwrite another program with the same hash.
+				newKey = key
+			}
+			mgr.corpusDB.Delete(key)
+			repaired[newKey] = rec.Val
+		}
+		corpus = append(corpus, p)
+		mgr.candidates = append(mgr.candidates, RpcCandidate{Prog: rec.Val, Minimized: true})
+	}
+	for key, data := range repaired {
+		mgr.corpusDB.Save(key, data, 0)
+	}
+	if err := mgr.corpusDB.Flush(); err != nil {
+		Fatalf("failed to save corpus database: %v", err)
+	}
+	Logf(0, "loaded %v programs (%v repaired) from %v", len(mgr.candidates), len(repaired), workdir)
+	mgr.prios = prog.CalculatePriorities(corpus)
+	serv, err := NewRpcServer("localhost:0", mgr, false)
+	if err != nil {
+		Fatalf("failed to create rpc server: %v", err)
+	}
+	go serv.Serve()
+	go mgr.printStats()
+	return serv.Addr().String()
+}
+
+// progsDir returns directory for the last programs executed by fuzzing processes.
+func progsDir(workdir string) string {
+	return filepath.Join(workdir, "progs")
+}
+
+// bootIDFile holds boot ID of the kernel the programs in progs dir are executed on.
+func bootIDFile(workdir string) string {
+	return filepath.Join(progsDir(workdir), "boot_id")
+}
+
+// bootID returns unique ID of the current kernel boot, or "" if it's unknown.
+func bootID() string {
+	data, err := ioutil.ReadFile("/proc/sys/kernel/random/boot_id")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// saveCrashPrograms preserves the last programs executed by the previous run
+// if the kernel crashed (rebooted) since then. Programs left by a fuzzer exit
+// without a kernel crash (e.g. on a fatal error) are removed.
+func saveCrashPrograms(workdir string) {
+	dir := progsDir(workdir)
+	if !osutil.IsExist(dir) {
+		return
+	}
+	if data, err := ioutil.ReadFile(bootIDFile(workdir)); err == nil {
+		if id := bootID(); id != "" && id == string(data) {
+			Logf(0, "previous run exited without kernel crash, removing its last programs")
+			if err := os.RemoveAll(dir); err != nil {
+				Fatalf("failed to remove programs of the previous run: %v", err)
+			}
+			return
+		}
+	}
+	crashdir := filepath.Join(workdir, "crashes", time.Now().Format("2006-01-02-15-04-05"))
+	if err := osutil.MkdirAll(filepath.Dir(crashdir)); err != nil {
+		Fatalf("failed to create crashes dir: %v", err)
+	}
+	if err := os.Rename(dir, crashdir); err != nil {
+		Fatalf("failed to save programs of the previous run: %v", err)
+	}
+	Logf(0, "previous run was terminated abnormally, its last programs are saved to %v", crashdir)
+}
+
+func (mgr *Manager) Connect(a *ConnectArgs, r *ConnectRes) error {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	r.Version = ProtocolVersion
+	r.NeedCheck = !mgr.checked
+	r.Prios = mgr.prios
+	for _, inp := range mgr.corpus {
+		r.Inputs = append(r.Inputs, inp)
+	}
+	for s := range mgr.maxSignal {
+		r.MaxSignal = append(r.MaxSignal, s)
+	}
+	for s := range mgr.flakySignal {
+		r.FlakySignal = append(r.FlakySignal, s)
+	}
+	mgr.newFlaky = nil
+	// There is only one fuzzer, so we can give it all candidates at once.
+	r.Candidates = mgr.candidates
+	mgr.candidates = nil
+	return nil
+}
+
+func (mgr *Manager) Check(a *CheckArgs, r *int) error {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	Logf(0, "machine check: %v calls enabled, kcov=%v, kleakcheck=%v, faultinjection=%v",
+		len(a.Calls), a.Kcov, a.Leak, a.Fault)
+	if !a.Kcov {
+		Logf(0, "kcov is not supported, fuzzing without coverage feedback")
+	}
+	mgr.checked = true
+	return nil
+}
+
+func (mgr *Manager) NewInput(a *NewInputArgs, r *int) error {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	newSignal := false
+	for _, s := range a.Signal {
+		_, inCorpus := mgr.corpusSignal[s]
+		_, flaky := mgr.flakySignal[s]
+		if !inCorpus && !flaky {
+			newSignal = true
+			break
+		}
+	}
+	if !newSignal {
+		return nil
+	}
+	hashSig, err := prog.SemanticHashData(a.Prog)
+	if err != nil {
+		return fmt.Errorf("failed to deserialize input: %v", err)
+	}
+	sig := hashSig.String()
+	mgr.stats["manager new inputs"]++
+	cover.SignalAdd(mgr.corpusSignal, a.Signal)
+	if inp, ok := mgr.corpus[sig]; ok {
+		inp.Signal = Signal(cover.Union(cover.Cover(inp.Signal), cover.Cover(a.Signal)))
+		mgr.corpus[sig] = inp
+		return nil
+	}
+	inp := a.RpcInput
+	inp.Cover = nil // the fuzzer does not need coverage of its own inputs
+	mgr.corpus[sig] = inp
+	mgr.corpusDB.Save(sig, a.Prog, 0)
+	if err := mgr.corpusDB.Flush(); err != nil {
+		Logf(0, "failed to save corpus database: %v", err)
+	}
+	return nil
+}
+
+func (mgr *Manager) Poll(a *PollArgs, r *PollRes) error {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	for k, v := range a.Stats {
+		mgr.stats[k] += v
+	}
+	cover.SignalAdd(mgr.maxSignal, a.MaxSignal)
+	// There is nobody to confirm flakiness, so single report is enough.
+	for _, s := range a.FlakySignal {
+		if _, ok := mgr.flakySignal[s]; !ok {
+			mgr.flakySignal[s] = struct{}{}
+			mgr.newFlaky = append(mgr.newFlaky, s)
+		}
+	}
+	r.FlakySignal = mgr.newFlaky
+	mgr.newFlaky = nil
+	return nil
+}
+
+func (mgr *Manager) printStats() {
+	for range time.NewTicker(standaloneStatsPeriod).C {
+		mgr.mu.Lock()
+		stats := []string{
+			fmt.Sprintf("uptime: %v", time.Since(mgr.startTime)/1e9*1e9),
+			fmt.Sprintf("corpus: %v", len(mgr.corpus)),
+			fmt.Sprintf("signal: %v", len(mgr.corpusSignal)),
+			fmt.Sprintf("max signal: %v", len(mgr.maxSignal)),
+			fmt.Sprintf("flaky signal: %v", len(mgr.flakySignal)),
+		}
+		var other []string
+		for k, v := range mgr.stats {
+			other = append(other, fmt.Sprintf("%v: %v", k, v))
+		}
+		mgr.mu.Unlock()
+		sort.Strings(other)
+		stats = append(stats, other...)
+		Logf(0, "stats:")
+		for _, s := range stats {
+			Logf(0, "\t%v", s)
+		}
+	}
+}
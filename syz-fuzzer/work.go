@@ -0,0 +1,222 @@
+// Copyright 2017 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+type workKind int
+
+const (
+	workTriageCandidate workKind = iota // triage of inputs found while executing candidates
+	workCandidate                       // execution of candidates received from manager
+	workTriage                          // triage of inputs found by fuzzing
+	workSmash                           // smashing of newly added corpus inputs
+	workGenerate                        // generation of a new program
+	workFuzz                            // mutation of a corpus program
+	workKindCount
+)
+
+var workKindNames = [workKindCount]string{
+	workTriageCandidate: "triage candidate",
+	workCandidate:       "candidate",
+	workTriage:          "triage",
+	workSmash:           "smash",
+	workGenerate:        "generate",
+	workFuzz:            "fuzz",
+}
+
+// Names of work kinds that have configurable ratios.
+// Candidates are always processed first since they constitute the corpus.
+var workRatioNames = map[string]workKind{
+	"triage":   workTriage,
+	"smash":    workSmash,
+	"generate": workGenerate,
+	"fuzz":     workFuzz,
+}
+
+// defaultWorkRatios together with the priority schedule give the classical order:
+// candidates, triage, smash and then generation of every 100-th program and mutation.
+var defaultWorkRatios = [workKindCount]float64{
+	workTriageCandidate: 1,
+	workCandidate:       1,
+	workTriage:          1,
+	workSmash:           1,
+	workGenerate:        0.01,
+	workFuzz:            1,
+}
+
+// workScheduler decides what a fuzzing process does next.
+type workScheduler interface {
+	// next returns kind of the next work, pending[k] is the number of available items of kind k
+	// (for generate it's always 1, for fuzz it's the corpus size).
+	// The returned kind must have pending items.
+	next(r *rand.Rand, pending *[workKindCount]int) workKind
+}
+
+func newWorkScheduler(name, ratios string) (workScheduler, error) {
+	r, err := parseWorkRatios(ratios)
+	if err != nil {
+		return nil, err
+	}
+	switch name {
+	case "priority":
+		for kind, v := range r {
+			if v > 1 {
+				return nil, fmt.Errorf("bad work ratio for %v: %v, want [0, 1] for priority schedule",
+					workKindNames[kind], v)
+			}
+		}
+		return &priorityScheduler{r}, nil
+	case "weighted":
+		return &weightedScheduler{r}, nil
+	default:
+		return nil, fmt.Errorf("unknown work schedule '%v', want one of priority/weighted", name)
+	}
+}
+
+// parseWorkRatios parses ratios in the form "smash=0.5,generate=0.1",
+// kinds that are not mentioned get default ratios.
+func parseWorkRatios(s string) ([workKindCount]float64, error) {
+	ratios := defaultWorkRatios
+	if s == "" {
+		return ratios, nil
+	}
+	for _, kv := range strings.Split(s, ",") {
+		eq := strings.IndexByte(kv, '=')
+		if eq == -1 {
+			return ratios, fmt.Errorf("bad work ratio '%v', want kind=ratio", kv)
+		}
+		kind, ok := workRatioNames[kv[:eq]]
+		if !ok {
+			return ratios, fmt.Errorf("unknown work kind '%v', want one of triage/smash/generate/fuzz", kv[:eq])
+		}
+		v, err := strconv.ParseFloat(kv[eq+1:], 64)
+		if err != nil || v < 0 {
+			return ratios, fmt.Errorf("bad work ratio for %v: '%v'", kv[:eq], kv[eq+1:])
+		}
+		ratios[kind] = v
+	}
+	return ratios, nil
+}
+
+// priorityScheduler processes work in the order of kinds.
+// Ratio of a kind is the probability to take pending work of that kind
+// instead of proceeding to the next kind; for generate it's probability
+// of generating a new program instead of mutating an existing one.
+type priorityScheduler struct {
+	ratios [workKindCount]float64
+}
+
+func (s *priorityScheduler) next(r *rand.Rand, pending *[workKindCount]int) workKind {
+	for kind := workTriageCandidate; kind < workFuzz; kind++ {
+		ratio := s.ratios[kind]
+		if pending[kind] != 0 && ratio != 0 && (ratio >= 1 || r.Float64() < ratio) {
+			return kind
+		}
+	}
+	if pending[workFuzz] != 0 {
+		return workFuzz
+	}
+	return workGenerate
+}
+
+// weightedScheduler chooses kind of work randomly among kinds with pending work
+// proportionally to their ratios (except for candidates that are always processed first).
+type weightedScheduler struct {
+	ratios [workKindCount]float64
+}
+
+func (s *weightedScheduler) next(r *rand.Rand, pending *[workKindCount]int) workKind {
+	if pending[workTriageCandidate] != 0 {
+		return workTriageCandidate
+	}
+	if pending[workCandidate] != 0 {
+		return workCandidate
+	}
+	total := 0.0
+	for kind := workTriage; kind < workKindCount; kind++ {
+		if pending[kind] != 0 {
+			total += s.ratios[kind]
+		}
+	}
+	if total == 0 {
+		return workGenerate
+	}
+	x := r.Float64() * total
+	for kind := workTriage; kind < workKindCount; kind++ {
+		if pending[kind] == 0 {
+			continue
+		}
+		if x < s.ratios[kind] {
+			return kind
+		}
+		x -= s.ratios[kind]
+	}
+	return workGenerate
+}
+
+// work is a single unit of work for a fuzzing process.
+type work struct {
+	kind      workKind
+	inp       Input     // for triage and smash
+	candidate Candidate // for candidate
+	wakePoll  bool      // candidates are running low
+}
+
+var statWork [workKindCount]uint64 // number of processed work items per kind
+
+// nextWork chooses the next work with the work scheduler and removes it from the corresponding queue.
+func nextWork(r *rand.Rand) *work {
+	var pending [workKindCount]int
+	pending[workGenerate] = 1
+	corpusMu.RLock()
+	pending[workFuzz] = len(corpus)
+	corpusMu.RUnlock()
+
+	// Fast path: queues are empty most of the time in steady state,
+	// don't contend on the write lock then.
+	triageMu.RLock()
+	empty := len(triageCandidate) == 0 && len(candidates) == 0 && len(triage) == 0 && len(smashQueue) == 0
+	triageMu.RUnlock()
+	if empty {
+		w := &work{kind: workSched.next(r, &pending)}
+		atomic.AddUint64(&statWork[w.kind], 1)
+		return w
+	}
+
+	triageMu.Lock()
+	defer triageMu.Unlock()
+	pending[workTriageCandidate] = len(triageCandidate)
+	pending[workCandidate] = len(candidates)
+	pending[workTriage] = len(triage)
+	pending[workSmash] = len(smashQueue)
+	w := &work{kind: workSched.next(r, &pending)}
+	atomic.AddUint64(&statWork[w.kind], 1)
+	switch w.kind {
+	case workTriageCandidate:
+		last := len(triageCandidate) - 1
+		w.inp = triageCandidate[last]
+		triageCandidate = triageCandidate[:last]
+	case workCandidate:
+		last := len(candidates) - 1
+		w.candidate = candidates[last]
+		candidates = candidates[:last]
+		w.wakePoll = len(candidates) < *flagProcs
+	case workTriage:
+		last := len(triage) - 1
+		w.inp = triage[last]
+		triage = triage[:last]
+	case workSmash:
+		last := len(smashQueue) - 1
+		w.inp = smashQueue[last]
+		smashQueue = smashQueue[:last]
+	}
+	return w
+}
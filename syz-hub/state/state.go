@@ -13,7 +13,6 @@ import (
 	"time"
 
 	"github.com/google/syzkaller/pkg/db"
-	"github.com/google/syzkaller/pkg/hash"
 	. "github.com/google/syzkaller/pkg/log"
 	"github.com/google/syzkaller/pkg/osutil"
 	"github.com/google/syzkaller/prog"
@@ -56,21 +55,38 @@ func Make(dir string) (*State, error) {
 		Fatalf("failed to open corpus database: %v", err)
 	}
 	Logf(0, "read %v programs", len(st.Corpus.Records))
+	// Programs are keyed by semantic hash (see prog.SemanticHash).
+	// Programs saved under other keys are re-saved under the semantic hash,
+	// or kept under the old key if the corpus already contains a program with the same hash.
+	// rekeyed maps old keys to new keys, it is used to update manager corpuses.
+	rekeyed := make(map[string]string)
 	for key, rec := range st.Corpus.Records {
 		if _, err := prog.CallSet(rec.Val); err != nil {
 			Logf(0, "bad file in corpus: can't parse call set: %v", err)
 			st.Corpus.Delete(key)
 			continue
 		}
-		if sig := hash.Hash(rec.Val); sig.String() != key {
-			Logf(0, "bad file in corpus: hash %v, want hash %v", key, sig.String())
+		if st.seq < rec.Seq {
+			st.seq = rec.Seq
+		}
+		sig, err := prog.SemanticHashData(rec.Val)
+		if err != nil {
+			Logf(0, "bad file in corpus: can't deserialize: %v", err)
 			st.Corpus.Delete(key)
 			continue
 		}
-		if st.seq < rec.Seq {
-			st.seq = rec.Seq
+		if newKey := sig.String(); newKey != key {
+			if _, ok := st.Corpus.Records[newKey]; ok {
+				continue
+			}
+			st.Corpus.Delete(key)
+			rekeyed[key] = newKey
+			st.Corpus.Save(newKey, rec.Val, rec.Seq)
 		}
 	}
+	if len(rekeyed) != 0 {
+		Logf(0, "rekeyed %v programs, %v programs left", len(rekeyed), len(st.Corpus.Records))
+	}
 	if err := st.Corpus.Flush(); err != nil {
 		Fatalf("failed to flush corpus database: %v", err)
 	}
@@ -98,6 +114,17 @@ func Make(dir string) (*State, error) {
 			return nil, fmt.Errorf("failed to open manager corpus database %v: %v", mgr.dir, err)
 		}
 		Logf(0, "read %v programs", len(mgr.Corpus.Records))
+		if len(rekeyed) != 0 {
+			for key := range mgr.Corpus.Records {
+				if newKey, ok := rekeyed[key]; ok {
+					mgr.Corpus.Delete(key)
+					mgr.Corpus.Save(newKey, nil, 0)
+				}
+			}
+			if err := mgr.Corpus.Flush(); err != nil {
+				return nil, fmt.Errorf("failed to flush manager corpus database %v: %v", mgr.dir, err)
+			}
+		}
 	}
 	Logf(0, "purging corpus...")
 	st.purgeCorpus()
@@ -226,7 +253,12 @@ func (st *State) addInput(mgr *Manager, input []byte) {
 		Logf(0, "manager %v: failed to extract call set: %v, program:\n%v", mgr.name, err, string(input))
 		return
 	}
-	sig := hash.String(input)
+	hashSig, err := prog.SemanticHashData(input)
+	if err != nil {
+		Logf(0, "manager %v: failed to deserialize program: %v, program:\n%v", mgr.name, err, string(input))
+		return
+	}
+	sig := hashSig.String()
 	mgr.Corpus.Save(sig, nil, 0)
 	if _, ok := st.Corpus.Records[sig]; !ok {
 		st.Corpus.Save(sig, input, st.seq)
@@ -0,0 +1,153 @@
+// Copyright 2017 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/syzkaller/pkg/cover"
+	. "github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/pkg/osutil"
+)
+
+const signalCheckpointPeriod = 10 * time.Minute
+
+// signalCheckpoint is periodically saved to workdir/signal.checkpoint
+// and restored on restart if the kernel is not changed.
+// Corpus signal is not saved: it's rebuilt from the inputs that are actually
+// in the corpus, otherwise signal of inputs that failed re-triage would be kept.
+type signalCheckpoint struct {
+	Kernel      string // kernelID the signal was collected on
+	MaxSignal   []uint32
+	CorpusCover []uint32
+	FlakySignal []uint32
+}
+
+func (mgr *Manager) checkpointFile() string {
+	return filepath.Join(mgr.cfg.Workdir, "signal.checkpoint")
+}
+
+// loadSignal restores corpus coverage from the checkpoint right away.
+// Max signal is restored only after corpus is triaged:
+// with this signal fuzzers would not consider corpus inputs as new.
+func (mgr *Manager) loadSignal() {
+	if mgr.kernelID == "" {
+		return
+	}
+	data, err := ioutil.ReadFile(mgr.checkpointFile())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			Logf(0, "failed to read signal checkpoint: %v", err)
+		}
+		return
+	}
+	ckpt, err := decodeSignalCheckpoint(data)
+	if err != nil {
+		Logf(0, "failed to decode signal checkpoint: %v", err)
+		return
+	}
+	if ckpt.Kernel != mgr.kernelID {
+		Logf(0, "kernel changed, discarding signal checkpoint")
+		return
+	}
+	cover.SignalAdd(mgr.corpusCover, ckpt.CorpusCover)
+	cover.SignalAdd(mgr.flakySignal, ckpt.FlakySignal)
+	mgr.savedSignal = ckpt
+	Logf(0, "loaded signal checkpoint (max signal %v, cover %v, flaky signal %v)",
+		len(ckpt.MaxSignal), len(ckpt.CorpusCover), len(ckpt.FlakySignal))
+}
+
+// restoreSavedSignal merges max signal from the checkpoint once corpus is triaged.
+// Must be called with mgr.mu held.
+func (mgr *Manager) restoreSavedSignal() {
+	if mgr.savedSignal == nil || mgr.phase == phaseInit || len(mgr.candidates) != 0 {
+		return
+	}
+	diff := cover.SignalDiff(mgr.maxSignal, mgr.savedSignal.MaxSignal)
+	cover.SignalAdd(mgr.maxSignal, diff)
+	for _, f := range mgr.fuzzers {
+		f.newMaxSignal = append(f.newMaxSignal, diff...)
+	}
+	Logf(0, "restored %v max signal from checkpoint", len(diff))
+	mgr.savedSignal = nil
+}
+
+func (mgr *Manager) checkpointSignalLoop() {
+	for {
+		time.Sleep(signalCheckpointPeriod)
+		mgr.mu.Lock()
+		// Restore only here rather than right after the last candidate is sent,
+		// so that fuzzers have time to finish triage of the last candidates.
+		mgr.restoreSavedSignal()
+		mgr.mu.Unlock()
+		mgr.checkpointSignal()
+	}
+}
+
+// checkpointSignal saves the current signal to the checkpoint file.
+// It's called periodically and on shutdown.
+func (mgr *Manager) checkpointSignal() {
+	if mgr.kernelID == "" {
+		return
+	}
+	mgr.mu.Lock()
+	ckpt := &signalCheckpoint{
+		Kernel:      mgr.kernelID,
+		MaxSignal:   signalSlice(mgr.maxSignal),
+		CorpusCover: signalSlice(mgr.corpusCover),
+		FlakySignal: signalSlice(mgr.flakySignal),
+	}
+	if saved := mgr.savedSignal; saved != nil {
+		// Not restored yet, preserve it in the new checkpoint.
+		ckpt.MaxSignal = append(ckpt.MaxSignal, saved.MaxSignal...)
+	}
+	mgr.mu.Unlock()
+	if err := saveSignalCheckpoint(mgr.checkpointFile(), ckpt); err != nil {
+		Logf(0, "failed to save signal checkpoint: %v", err)
+	}
+}
+
+func signalSlice(m map[uint32]struct{}) []uint32 {
+	res := make([]uint32, 0, len(m))
+	for s := range m {
+		res = append(res, s)
+	}
+	return res
+}
+
+func saveSignalCheckpoint(filename string, ckpt *signalCheckpoint) error {
+	buf := new(bytes.Buffer)
+	w := gzip.NewWriter(buf)
+	if err := gob.NewEncoder(w).Encode(ckpt); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	// Write to a temp file first to not corrupt the previous checkpoint on crash.
+	tmp := filename + ".tmp"
+	if err := osutil.WriteFile(tmp, buf.Bytes()); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+func decodeSignalCheckpoint(data []byte) (*signalCheckpoint, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	ckpt := new(signalCheckpoint)
+	if err := gob.NewDecoder(r).Decode(ckpt); err != nil {
+		return nil, fmt.Errorf("failed to decode: %v", err)
+	}
+	return ckpt, nil
+}
@@ -0,0 +1,51 @@
+// Copyright 2017 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSignalCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "syz-manager-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "signal.checkpoint")
+	ckpt := &signalCheckpoint{
+		Kernel:      "0123456789abcdef",
+		MaxSignal:   []uint32{1, 2, 3, 0xffffffff},
+		CorpusCover: []uint32{0x81000000},
+		FlakySignal: []uint32{3},
+	}
+	for i := 0; i < 2; i++ {
+		// The second save overwrites the existing checkpoint.
+		if err := saveSignalCheckpoint(filename, ckpt); err != nil {
+			t.Fatalf("failed to save checkpoint: %v", err)
+		}
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ckpt1, err := decodeSignalCheckpoint(data)
+		if err != nil {
+			t.Fatalf("failed to decode checkpoint: %v", err)
+		}
+		if !reflect.DeepEqual(ckpt, ckpt1) {
+			t.Fatalf("checkpoint is corrupted:\nwant: %+v\ngot:  %+v", ckpt, ckpt1)
+		}
+		ckpt.MaxSignal = append(ckpt.MaxSignal, 4)
+	}
+	if _, err := os.Stat(filename + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("temp checkpoint file is not removed: %v", err)
+	}
+	if _, err := decodeSignalCheckpoint([]byte("garbage")); err == nil {
+		t.Fatalf("decoded garbage checkpoint")
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2017 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/google/syzkaller/pkg/hash"
+	. "github.com/google/syzkaller/pkg/log"
+	. "github.com/google/syzkaller/pkg/rpctype"
+	"github.com/google/syzkaller/prog"
+)
+
+// Signal and coverage of corpus inputs are persisted in corpus-info.db under the same keys
+// as programs in corpus.db. corpus.db itself contains only programs, so that it stays
+// compatible with syz-hub and tools. If the kernel is not changed between restarts,
+// inputs are restored from the info without re-triage (see skip_retriage config param).
+type inputInfo struct {
+	Kernel    string // kernelID of the kernel the input was triaged on
+	Call      string
+	CallIndex int
+	Signal    []uint32
+	Cover     []uint32
+}
+
+func (mgr *Manager) saveInputInfo(key string, inp RpcInput) {
+	info := &inputInfo{
+		Kernel:    mgr.kernelID,
+		Call:      inp.Call,
+		CallIndex: inp.CallIndex,
+		Signal:    inp.Signal,
+		Cover:     inp.Cover,
+	}
+	buf := new(bytes.Buffer)
+	if err := gob.NewEncoder(buf).Encode(info); err != nil {
+		panic(err)
+	}
+	mgr.infoMu.Lock()
+	mgr.infoDB.Save(key, buf.Bytes(), 0)
+	mgr.infoMu.Unlock()
+}
+
+// Info is saved for every new corpus input, so it's flushed in batches
+// rather than on every save (flush can compact the whole database).
+const inputInfoFlushPeriod = time.Minute
+
+func (mgr *Manager) flushInputInfoLoop() {
+	for {
+		time.Sleep(inputInfoFlushPeriod)
+		mgr.flushInputInfo()
+	}
+}
+
+func (mgr *Manager) flushInputInfo() {
+	mgr.infoMu.Lock()
+	defer mgr.infoMu.Unlock()
+	if err := mgr.infoDB.Flush(); err != nil {
+		Logf(0, "failed to save corpus info database: %v", err)
+	}
+}
+
+// restoreInput returns the corpus input with the key if it was triaged on the current kernel.
+func (mgr *Manager) restoreInput(key string, p *prog.Prog, data []byte) (RpcInput, bool) {
+	rec, ok := mgr.infoDB.Records[key]
+	if !ok || mgr.kernelID == "" {
+		return RpcInput{}, false
+	}
+	info := new(inputInfo)
+	if err := gob.NewDecoder(bytes.NewReader(rec.Val)).Decode(info); err != nil {
+		Logf(0, "failed to decode corpus info for %v: %v", key, err)
+		return RpcInput{}, false
+	}
+	if info.Kernel != mgr.kernelID || info.CallIndex < 0 || info.CallIndex >= len(p.Calls) ||
+		p.Calls[info.CallIndex].Meta.CallName != info.Call || len(info.Signal) == 0 {
+		return RpcInput{}, false
+	}
+	inp := RpcInput{
+		Call:      info.Call,
+		Prog:      data,
+		CallIndex: info.CallIndex,
+		Signal:    info.Signal,
+		Cover:     info.Cover,
+	}
+	return inp, true
+}
+
+// kernelID identifies the kernel and the cover filter signal is collected with:
+// signal is not comparable across runs if either of them changes.
+func kernelID(vmlinux string, filter [][2]uint32) (string, error) {
+	id, err := kernelBuildID(vmlinux)
+	if err != nil || len(filter) == 0 {
+		return id, err
+	}
+	buf := new(bytes.Buffer)
+	for _, r := range filter {
+		fmt.Fprintf(buf, "%x-%x\n", r[0], r[1])
+	}
+	return id + "-" + hash.String(buf.Bytes()), nil
+}
+
+// kernelBuildID returns GNU build ID of vmlinux, or hash of the file if it does not have one.
+func kernelBuildID(vmlinux string) (string, error) {
+	f, err := elf.Open(vmlinux)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	for _, sec := range f.Sections {
+		if sec.Type != elf.SHT_NOTE {
+			continue
+		}
+		data, err := sec.Data()
+		if err != nil {
+			return "", err
+		}
+		if id := parseBuildID(data, f.ByteOrder); id != "" {
+			return id, nil
+		}
+	}
+	data, err := ioutil.ReadFile(vmlinux)
+	if err != nil {
+		return "", err
+	}
+	return hash.String(data), nil
+}
+
+// parseBuildID extracts NT_GNU_BUILD_ID from ELF notes.
+func parseBuildID(notes []byte, order binary.ByteOrder) string {
+	const ntGNUBuildID = 3
+	align := func(v uint32) int { return int((v + 3) &^ 3) }
+	for len(notes) >= 12 {
+		nameSize, descSize, typ := order.Uint32(notes), order.Uint32(notes[4:]), order.Uint32(notes[8:])
+		size := 12 + align(nameSize) + align(descSize)
+		if nameSize > 1<<10 || descSize > 1<<10 || len(notes) < size {
+			break
+		}
+		if typ == ntGNUBuildID && nameSize == 4 && string(notes[12:15]) == "GNU" {
+			desc := notes[12+align(nameSize):]
+			return hex.EncodeToString(desc[:descSize])
+		}
+		notes = notes[size:]
+	}
+	return ""
+}
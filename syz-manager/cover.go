@@ -254,13 +254,7 @@ func uncoveredPcsInFuncs(vmlinux string, pcs []uint64) ([]uint64, error) {
 	if allSymbols == nil {
 		return nil, fmt.Errorf("failed to run nm on vmlinux")
 	}
-	var symbols symbolArray
-	for name, ss := range allSymbols {
-		for _, s := range ss {
-			symbols = append(symbols, symbol{s.Addr, s.Addr + uint64(s.Size), name})
-		}
-	}
-	sort.Sort(symbols)
+	symbols := sortedSymbols()
 
 	<-allCoverReady
 	if len(allCoverPCs) == 0 {
@@ -0,0 +1,70 @@
+// Copyright 2017 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/syzkaller/pkg/cover"
+	. "github.com/google/syzkaller/pkg/log"
+)
+
+// resolveCoverFilter resolves cover filter entries (functions, source files or raw PC ranges
+// in the form 0xffffffff81000000-0xffffffff81100000) to sorted non-overlapping [start, end)
+// ranges of coverage PCs (in the form reported by kcov).
+func resolveCoverFilter(vmlinux string, filter []string) ([][2]uint32, error) {
+	<-allSymbolsReady
+	var ranges [][2]uint32
+	var files []string
+	for _, entry := range filter {
+		if dash := strings.IndexByte(entry, '-'); strings.HasPrefix(entry, "0x") && dash != -1 {
+			start, err1 := strconv.ParseUint(entry[:dash], 0, 64)
+			end, err2 := strconv.ParseUint(entry[dash+1:], 0, 64)
+			if err1 != nil || err2 != nil || start >= end {
+				return nil, fmt.Errorf("bad PC range in cover filter: %v", entry)
+			}
+			ranges = append(ranges, [2]uint32{uint32(start), uint32(end)})
+			continue
+		}
+		if isTargetFile(entry) {
+			files = append(files, entry)
+			continue
+		}
+		if allSymbols == nil {
+			return nil, fmt.Errorf("failed to run nm on vmlinux")
+		}
+		if len(allSymbols[entry]) == 0 {
+			return nil, fmt.Errorf("unknown function in cover filter: %v", entry)
+		}
+		for _, s := range allSymbols[entry] {
+			ranges = append(ranges, [2]uint32{uint32(s.Addr), uint32(s.Addr + uint64(s.Size))})
+		}
+	}
+	if len(files) != 0 {
+		pcs, err := filesCoverPCs(vmlinux, files)
+		if err != nil {
+			return nil, err
+		}
+		if len(pcs) == 0 {
+			return nil, fmt.Errorf("no coverage PCs in cover filter files %v", files)
+		}
+		for _, pc := range pcs {
+			ranges = append(ranges, [2]uint32{uint32(pc + callLen), uint32(pc + callLen + 1)})
+		}
+	}
+	ranges = cover.MergeRanges(ranges)
+	Logf(0, "resolved cover filter to %v PC ranges", len(ranges))
+	return ranges, nil
+}
+
+// coverFilterContains returns true if pc is in one of the ranges returned by resolveCoverFilter.
+func coverFilterContains(ranges [][2]uint32, pc uint32) bool {
+	idx := sort.Search(len(ranges), func(i int) bool {
+		return pc < ranges[i][1]
+	})
+	return idx < len(ranges) && ranges[idx][0] <= pc
+}
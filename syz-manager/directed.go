@@ -0,0 +1,236 @@
+// Copyright 2017 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+
+	. "github.com/google/syzkaller/pkg/log"
+)
+
+// Functions that call target functions through at most maxTargetDistance calls
+// are considered close to targets.
+const maxTargetDistance = 3
+
+// resolveTargets resolves fuzzing targets in config to coverage PCs
+// and makes them available to fuzzers.
+func (mgr *Manager) resolveTargets() {
+	targets, err := resolveTargets(mgr.cfg.Vmlinux, mgr.cfg.Targets)
+	if err != nil {
+		Logf(0, "failed to resolve fuzzing targets: %v", err)
+		return
+	}
+	mgr.mu.Lock()
+	mgr.targets = targets
+	mgr.mu.Unlock()
+}
+
+// targetCover returns part of cov that is close to fuzzing targets.
+func (mgr *Manager) targetCover(cov []uint32) []uint32 {
+	var res []uint32
+	for _, pc := range cov {
+		if _, ok := mgr.targets[pc]; ok {
+			res = append(res, pc)
+		}
+	}
+	return res
+}
+
+// resolveTargets returns coverage PCs (in the form reported by kcov) of target functions
+// and source files (with distance 0) and of functions that call them (distance is the
+// number of calls in between, up to maxTargetDistance).
+func resolveTargets(vmlinux string, targets []string) (map[uint32]int, error) {
+	<-allSymbolsReady
+	<-allCoverReady
+	if allSymbols == nil || len(allCoverPCs) == 0 {
+		return nil, fmt.Errorf("no symbols or coverage PCs in vmlinux")
+	}
+	symbols := sortedSymbols()
+	dist := make(map[string]int) // function -> distance to targets
+	var files []string
+	for _, target := range targets {
+		if isTargetFile(target) {
+			files = append(files, target)
+			continue
+		}
+		if len(allSymbols[target]) == 0 {
+			Logf(0, "unknown target function %v", target)
+			continue
+		}
+		dist[target] = 0
+	}
+	res := make(map[uint32]int)
+	if len(files) != 0 {
+		pcs, err := filesCoverPCs(vmlinux, files)
+		if err != nil {
+			return nil, err
+		}
+		for _, pc := range pcs {
+			res[uint32(pc+callLen)] = 0
+			if s := findSymbol(symbols, pc); s != nil {
+				dist[s.name] = 0
+			}
+		}
+	}
+	if len(dist) == 0 {
+		return nil, fmt.Errorf("none of the targets are found in vmlinux")
+	}
+	callers, err := callGraph(vmlinux)
+	if err != nil {
+		return nil, err
+	}
+	var queue []string
+	for fn := range dist {
+		queue = append(queue, fn)
+	}
+	for len(queue) != 0 {
+		fn := queue[0]
+		queue = queue[1:]
+		d := dist[fn] + 1
+		if d > maxTargetDistance {
+			continue
+		}
+		for _, caller := range callers[fn] {
+			if _, ok := dist[caller]; !ok {
+				dist[caller] = d
+				queue = append(queue, caller)
+			}
+		}
+	}
+	for fn, d := range dist {
+		for _, s := range allSymbols[fn] {
+			start := sort.Search(len(allCoverPCs), func(i int) bool {
+				return s.Addr <= allCoverPCs[i]
+			})
+			for _, pc := range allCoverPCs[start:] {
+				if pc >= s.Addr+uint64(s.Size) {
+					break
+				}
+				if _, ok := res[uint32(pc+callLen)]; !ok {
+					res[uint32(pc+callLen)] = d
+				}
+			}
+		}
+	}
+	Logf(0, "resolved %v fuzzing targets to %v functions and %v coverage PCs", len(targets), len(dist), len(res))
+	return res, nil
+}
+
+// filesCoverPCs returns PCs of coverage callbacks (see coveredPCs) that belong to the source files
+// (including code inlined from the files). Files can be specified relative to the kernel source dir.
+func filesCoverPCs(vmlinux string, files []string) ([]uint64, error) {
+	<-allCoverReady
+	frames, _, err := symbolize(vmlinux, allCoverPCs)
+	if err != nil {
+		return nil, err
+	}
+	var pcs []uint64
+	for _, frame := range frames {
+		for _, file := range files {
+			if frame.File == file || strings.HasSuffix(frame.File, "/"+file) {
+				// Frame PC was adjusted by symbolize, the original PC is frame.PC+1.
+				pcs = append(pcs, frame.PC+1)
+				break
+			}
+		}
+	}
+	return pcs, nil
+}
+
+// isTargetFile returns true if target denotes a source file rather than a function.
+func isTargetFile(target string) bool {
+	return strings.Contains(target, "/") || strings.HasSuffix(target, ".c") || strings.HasSuffix(target, ".h")
+}
+
+func sortedSymbols() symbolArray {
+	var symbols symbolArray
+	for name, ss := range allSymbols {
+		for _, s := range ss {
+			symbols = append(symbols, symbol{s.Addr, s.Addr + uint64(s.Size), name})
+		}
+	}
+	sort.Sort(symbols)
+	return symbols
+}
+
+func findSymbol(symbols symbolArray, pc uint64) *symbol {
+	idx := sort.Search(len(symbols), func(i int) bool {
+		return pc < symbols[i].end
+	})
+	if idx == len(symbols) || pc < symbols[idx].start {
+		return nil
+	}
+	return &symbols[idx]
+}
+
+// callGraph returns callers of every function in binary bin (only direct calls are accounted).
+func callGraph(bin string) (map[string][]string, error) {
+	cmd := exec.Command("objdump", "-d", "--no-show-raw-insn", bin)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	callers := make(map[string][]string)
+	seen := make(map[[2]string]bool)
+	fn := ""
+	s := bufio.NewScanner(stdout)
+	// Function starts with a line that looks as: "ffffffff81000000 <startup_64>:",
+	// a call looks as: "ffffffff8100206a:       callq  ffffffff815cc1d0 <kfree>"
+	// (newer binutils print "call" instead of "callq").
+	callInsns := [][]byte{[]byte("callq "), []byte("call ")}
+	for s.Scan() {
+		ln := s.Bytes()
+		if bytes.HasSuffix(ln, []byte(">:")) {
+			if pos := bytes.IndexByte(ln, '<'); pos != -1 {
+				fn = string(ln[pos+1 : len(ln)-2])
+			}
+			continue
+		}
+		pos := -1
+		for _, insn := range callInsns {
+			if pos = bytes.Index(ln, insn); pos != -1 {
+				pos += len(insn)
+				break
+			}
+		}
+		if pos == -1 || fn == "" {
+			continue
+		}
+		ln = bytes.TrimLeft(ln[pos:], " ")
+		if len(ln) != 0 && ln[0] == '*' {
+			continue // indirect call, the symbol is in a comment
+		}
+		start, end := bytes.IndexByte(ln, '<'), bytes.IndexByte(ln, '>')
+		if start == -1 || end < start || bytes.IndexByte(ln[start:end], '+') != -1 {
+			continue
+		}
+		callee := string(ln[start+1 : end])
+		if edge := [2]string{callee, fn}; !seen[edge] {
+			seen[edge] = true
+			callers[callee] = append(callers[callee], fn)
+		}
+	}
+	if err := s.Err(); err != nil {
+		// objdump would block on write to the pipe that nobody reads.
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, fmt.Errorf("failed to read objdump output: %v", err)
+	}
+	if err := cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("objdump failed: %v", err)
+	}
+	if len(callers) == 0 {
+		// Only x86 call instructions are recognized.
+		Logf(0, "no calls found in %v, fuzzing targets are resolved without callers", bin)
+	}
+	return callers, nil
+}
@@ -0,0 +1,60 @@
+// Copyright 2017 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	. "github.com/google/syzkaller/pkg/log"
+)
+
+// Signal is classified as flaky after it was not reproduced during triage
+// flakySignalReports times (possibly by different fuzzers). A single report
+// can be caused by a fuzzer or executor glitch rather than by non-determinism.
+const flakySignalReports = 2
+
+// Most reported signal is never reported again, so reports are dropped
+// once there are maxFlakyReports of them to bound memory consumption.
+const maxFlakyReports = 1 << 20
+
+// addFlakyReports accounts signal that was not reproduced during triage in a fuzzer
+// and sends newly classified flaky signal to all fuzzers. Must be called with mgr.mu held.
+func (mgr *Manager) addFlakyReports(signal []uint32) {
+	if len(mgr.flakyReports)+len(signal) > maxFlakyReports {
+		Logf(1, "dropping %v flaky signal reports", len(mgr.flakyReports))
+		mgr.flakyReports = make(map[uint32]int)
+	}
+	var flaky []uint32
+	for _, s := range signal {
+		if _, ok := mgr.flakySignal[s]; ok {
+			continue
+		}
+		mgr.flakyReports[s]++
+		if mgr.flakyReports[s] < flakySignalReports {
+			continue
+		}
+		delete(mgr.flakyReports, s)
+		mgr.flakySignal[s] = struct{}{}
+		flaky = append(flaky, s)
+	}
+	if len(flaky) == 0 {
+		return
+	}
+	Logf(1, "classified %v signal as flaky (%v total)", len(flaky), len(mgr.flakySignal))
+	for _, f := range mgr.fuzzers {
+		f.newFlakySignal = append(f.newFlakySignal, flaky...)
+	}
+}
+
+// newCorpusSignal returns true if signal has elements that are not in corpus
+// signal and are not flaky. Must be called with mgr.mu held.
+func (mgr *Manager) newCorpusSignal(signal []uint32) bool {
+	for _, s := range signal {
+		if _, ok := mgr.corpusSignal[s]; ok {
+			continue
+		}
+		if _, ok := mgr.flakySignal[s]; !ok {
+			return true
+		}
+	}
+	return false
+}
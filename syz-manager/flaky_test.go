@@ -0,0 +1,63 @@
+// Copyright 2017 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFlakyReports(t *testing.T) {
+	f0, f1 := new(Fuzzer), new(Fuzzer)
+	mgr := &Manager{
+		corpusSignal: map[uint32]struct{}{1: {}},
+		flakySignal:  make(map[uint32]struct{}),
+		flakyReports: make(map[uint32]int),
+		fuzzers:      map[string]*Fuzzer{"f0": f0, "f1": f1},
+	}
+	mgr.addFlakyReports([]uint32{2, 3})
+	if len(mgr.flakySignal) != 0 || f0.newFlakySignal != nil {
+		t.Fatalf("signal is classified as flaky after a single report")
+	}
+	if !mgr.newCorpusSignal([]uint32{1, 2}) {
+		t.Fatalf("signal reported once is not new")
+	}
+	mgr.addFlakyReports([]uint32{3, 4})
+	want := []uint32{3}
+	if !reflect.DeepEqual(f0.newFlakySignal, want) || !reflect.DeepEqual(f1.newFlakySignal, want) {
+		t.Fatalf("bad flaky signal sent to fuzzers: %v, %v, want %v",
+			f0.newFlakySignal, f1.newFlakySignal, want)
+	}
+	if _, ok := mgr.flakyReports[3]; ok || mgr.flakyReports[2] != 1 || mgr.flakyReports[4] != 1 {
+		t.Fatalf("bad flaky reports: %v", mgr.flakyReports)
+	}
+	// Already classified signal is not reported again.
+	mgr.addFlakyReports([]uint32{3})
+	if len(f0.newFlakySignal) != 1 || len(mgr.flakyReports) != 2 {
+		t.Fatalf("flaky signal is reported again")
+	}
+	if mgr.newCorpusSignal([]uint32{1, 3}) {
+		t.Fatalf("flaky signal is new")
+	}
+	if !mgr.newCorpusSignal([]uint32{3, 4}) {
+		t.Fatalf("non-flaky signal is not new")
+	}
+}
+
+func TestFlakyReportsLimit(t *testing.T) {
+	mgr := &Manager{
+		flakySignal:  make(map[uint32]struct{}),
+		flakyReports: make(map[uint32]int),
+	}
+	signal := make([]uint32, maxFlakyReports)
+	for i := range signal {
+		signal[i] = uint32(i)
+	}
+	mgr.addFlakyReports(signal)
+	mgr.addFlakyReports([]uint32{maxFlakyReports, 0})
+	if len(mgr.flakyReports) != 2 || len(mgr.flakySignal) != 0 {
+		t.Fatalf("flaky reports are not dropped: %v reports, %v flaky",
+			len(mgr.flakyReports), len(mgr.flakySignal))
+	}
+}
@@ -4,6 +4,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"html/template"
 	"io"
@@ -17,6 +18,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/google/syzkaller/pkg/cover"
@@ -35,6 +37,8 @@ func (mgr *Manager) initHttp() {
 	http.HandleFunc("/crash", mgr.httpCrash)
 	http.HandleFunc("/cover", mgr.httpCover)
 	http.HandleFunc("/prio", mgr.httpPrio)
+	http.HandleFunc("/syscalls", mgr.httpSyscalls)
+	http.HandleFunc("/syscalls.json", mgr.httpSyscallsJSON)
 	http.HandleFunc("/file", mgr.httpFile)
 	http.HandleFunc("/report", mgr.httpReport)
 
@@ -69,6 +73,30 @@ func (mgr *Manager) httpSummary(w http.ResponseWriter, r *http.Request) {
 	data.Stats = append(data.Stats, UIStat{Name: "triage queue", Value: fmt.Sprint(len(mgr.candidates))})
 	data.Stats = append(data.Stats, UIStat{Name: "cover", Value: fmt.Sprint(len(mgr.corpusCover)), Link: "/cover"})
 	data.Stats = append(data.Stats, UIStat{Name: "signal", Value: fmt.Sprint(len(mgr.corpusSignal))})
+	data.Stats = append(data.Stats, UIStat{Name: "flaky signal", Value: fmt.Sprint(len(mgr.flakySignal))})
+	if mgr.coverFilter != nil {
+		filtered := 0
+		for pc := range mgr.corpusCover {
+			if coverFilterContains(mgr.coverFilter, pc) {
+				filtered++
+			}
+		}
+		data.Stats = append(data.Stats, UIStat{Name: "filtered cover", Value: fmt.Sprint(filtered)})
+	}
+	data.Stats = append(data.Stats, UIStat{Name: "syscalls", Value: fmt.Sprint(len(mgr.callStats)), Link: "/syscalls"})
+	if len(mgr.cfg.Targets) != 0 {
+		targetCover, targetTotal := 0, 0
+		for pc, dist := range mgr.targets {
+			if dist != 0 {
+				continue
+			}
+			targetTotal++
+			if _, ok := mgr.corpusCover[pc]; ok {
+				targetCover++
+			}
+		}
+		data.Stats = append(data.Stats, UIStat{Name: "target cover", Value: fmt.Sprintf("%v/%v", targetCover, targetTotal)})
+	}
 
 	type CallCov struct {
 		count int
@@ -100,6 +128,21 @@ func (mgr *Manager) httpSummary(w http.ResponseWriter, r *http.Request) {
 	}
 	sort.Sort(UICallTypeArray(data.Calls))
 
+	failing := make(map[string]*UIFailingCall)
+	for _, f := range mgr.fuzzers {
+		for _, fc := range f.failingCalls {
+			ui := failing[fc.Name]
+			if ui == nil {
+				ui = &UIFailingCall{Name: fc.Name, Errno: fc.Errno}
+				failing[fc.Name] = ui
+				data.FailingCalls = append(data.FailingCalls, ui)
+			}
+			ui.Execs += fc.Execs
+			ui.Fuzzers++
+		}
+	}
+	sort.Sort(UIFailingCallArray(data.FailingCalls))
+
 	var intStats []UIStat
 	for k, v := range mgr.stats {
 		val := fmt.Sprintf("%v", v)
@@ -172,7 +215,7 @@ func (mgr *Manager) httpCover(w http.ResponseWriter, r *http.Request) {
 
 	var cov cover.Cover
 	if sig := r.FormValue("input"); sig != "" {
-		cov = mgr.corpus[sig].Cover
+		cov = cover.Cover(mgr.corpus[sig].Cover)
 	} else {
 		call := r.FormValue("call")
 		for _, inp := range mgr.corpus {
@@ -209,9 +252,14 @@ func (mgr *Manager) httpPrio(w http.ResponseWriter, r *http.Request) {
 
 	data := &UIPrioData{Call: call}
 	for i, p := range mgr.prios[idx] {
-		data.Prios = append(data.Prios, UIPrio{sys.Calls[i].Name, p})
+		weight, weighted := mgr.cfg.ParsedWeights[i]
+		data.Prios = append(data.Prios, UIPrio{sys.Calls[i].Name, p, weight, weighted})
 	}
 	sort.Sort(UIPrioArray(data.Prios))
+	for pattern, weight := range mgr.cfg.Syscall_Weights {
+		data.Weights = append(data.Weights, fmt.Sprintf("%v: %v", pattern, weight))
+	}
+	sort.Strings(data.Weights)
 
 	if err := prioTemplate.Execute(w, data); err != nil {
 		http.Error(w, fmt.Sprintf("failed to execute template: %v", err), http.StatusInternalServerError)
@@ -219,6 +267,75 @@ func (mgr *Manager) httpPrio(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (mgr *Manager) httpSyscalls(w http.ResponseWriter, r *http.Request) {
+	data := &UISyscallsData{
+		Name:     mgr.cfg.Name,
+		Syscalls: mgr.collectSyscalls(),
+	}
+	if err := syscallsTemplate.Execute(w, data); err != nil {
+		http.Error(w, fmt.Sprintf("failed to execute template: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (mgr *Manager) httpSyscallsJSON(w http.ResponseWriter, r *http.Request) {
+	data, err := json.MarshalIndent(mgr.collectSyscalls(), "", "\t")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to marshal json: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (mgr *Manager) collectSyscalls() []*UISyscall {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	inputs := make(map[string]int)
+	for _, inp := range mgr.corpus {
+		inputs[inp.Call]++
+	}
+	var res []*UISyscall
+	for name, stat := range mgr.callStats {
+		ui := &UISyscall{
+			Name:     name,
+			CallName: name,
+			Execs:    stat.Execs,
+			Success:  stat.Success,
+			Errnos:   make(map[int]uint64),
+			Signal:   stat.Signal,
+			Flaky:    stat.Flaky,
+		}
+		if c := sys.CallMap[name]; c != nil {
+			// Corpus inputs are accounted per base syscall (e.g. ioctl for ioctl$FOO).
+			ui.CallName = c.CallName
+		}
+		ui.Inputs = inputs[ui.CallName]
+		for errno, n := range stat.Errnos {
+			ui.Errnos[errno] = n
+		}
+		if stat.Execs != 0 {
+			ui.SuccessRate = float64(stat.Success) / float64(stat.Execs) * 100
+		}
+		var errnos []int
+		for errno := range stat.Errnos {
+			errnos = append(errnos, errno)
+		}
+		sort.Ints(errnos)
+		for _, errno := range errnos {
+			ui.TopErrnos = append(ui.TopErrnos, UIErrno{errno, syscall.Errno(errno).Error(), stat.Errnos[errno]})
+		}
+		sort.Stable(UIErrnoArray(ui.TopErrnos))
+		if len(ui.TopErrnos) > 5 {
+			ui.TopErrnos = ui.TopErrnos[:5]
+		}
+		res = append(res, ui)
+	}
+	sort.Sort(UISyscallArray(res))
+	return res
+}
+
 func (mgr *Manager) httpFile(w http.ResponseWriter, r *http.Request) {
 	mgr.mu.Lock()
 	defer mgr.mu.Unlock()
@@ -250,7 +367,7 @@ func (mgr *Manager) httpReport(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	tag, _ := ioutil.ReadFile(filepath.Join(mgr.crashdir, crashID, "repro.tag"))
-	prog, _ := ioutil.ReadFile(filepath.Join(mgr.crashdir, crashID, "repro.prog"))
+	progData, _ := ioutil.ReadFile(filepath.Join(mgr.crashdir, crashID, "repro.prog"))
 	cprog, _ := ioutil.ReadFile(filepath.Join(mgr.crashdir, crashID, "repro.cprog"))
 	rep, _ := ioutil.ReadFile(filepath.Join(mgr.crashdir, crashID, "repro.report"))
 	log, _ := ioutil.ReadFile(filepath.Join(mgr.crashdir, crashID, "repro.log"))
@@ -270,10 +387,13 @@ func (mgr *Manager) httpReport(w http.ResponseWriter, r *http.Request) {
 		}
 		fmt.Fprintf(w, "%s\n\n", rep)
 	}
-	if len(prog) == 0 && len(cprog) == 0 {
+	if len(progData) == 0 && len(cprog) == 0 {
 		fmt.Fprintf(w, "The bug is not reproducible.\n")
 	} else {
-		fmt.Fprintf(w, "Syzkaller reproducer:\n%s\n\n", prog)
+		fmt.Fprintf(w, "Syzkaller reproducer:\n%s\n\n", progData)
+		if p, err := prog.Deserialize(progData); err == nil && len(p.Calls) != 0 {
+			fmt.Fprintf(w, "Annotated reproducer:\n%s\n\n", p.Annotate(nil))
+		}
 		if len(cprog) != 0 {
 			fmt.Fprintf(w, "C reproducer:\n%s\n\n", cprog)
 		}
@@ -408,11 +528,43 @@ func trimNewLines(data []byte) []byte {
 }
 
 type UISummaryData struct {
+	Name         string
+	Stats        []UIStat
+	Calls        []UICallType
+	FailingCalls []*UIFailingCall
+	Crashes      []*UICrashType
+	Log          string
+}
+
+type UISyscallsData struct {
+	Name     string
+	Syscalls []*UISyscall
+}
+
+type UISyscall struct {
+	Name        string         `json:"name"`
+	CallName    string         `json:"call_name"`
+	Execs       uint64         `json:"execs"`
+	Success     uint64         `json:"success"`
+	SuccessRate float64        `json:"success_rate"` // in percents
+	Errnos      map[int]uint64 `json:"errnos"`
+	TopErrnos   []UIErrno      `json:"-"`
+	Signal      uint64         `json:"signal"`
+	Flaky       uint64         `json:"flaky"` // signal that was not reproduced during triage
+	Inputs      int            `json:"inputs"`
+}
+
+type UIErrno struct {
+	Errno int
+	Desc  string
+	Count uint64
+}
+
+type UIFailingCall struct {
 	Name    string
-	Stats   []UIStat
-	Calls   []UICallType
-	Crashes []*UICrashType
-	Log     string
+	Errno   int
+	Execs   uint64
+	Fuzzers int
 }
 
 type UICrashType struct {
@@ -459,6 +611,24 @@ func (a UICallTypeArray) Len() int           { return len(a) }
 func (a UICallTypeArray) Less(i, j int) bool { return a[i].Name < a[j].Name }
 func (a UICallTypeArray) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 
+type UISyscallArray []*UISyscall
+
+func (a UISyscallArray) Len() int           { return len(a) }
+func (a UISyscallArray) Less(i, j int) bool { return a[i].Name < a[j].Name }
+func (a UISyscallArray) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+
+type UIErrnoArray []UIErrno
+
+func (a UIErrnoArray) Len() int           { return len(a) }
+func (a UIErrnoArray) Less(i, j int) bool { return a[i].Count > a[j].Count }
+func (a UIErrnoArray) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+
+type UIFailingCallArray []*UIFailingCall
+
+func (a UIFailingCallArray) Len() int           { return len(a) }
+func (a UIFailingCallArray) Less(i, j int) bool { return a[i].Name < a[j].Name }
+func (a UIFailingCallArray) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+
 type UIInputArray []UIInput
 
 func (a UIInputArray) Len() int           { return len(a) }
@@ -545,6 +715,27 @@ var summaryTemplate = template.Must(template.New("").Parse(addStyle(`
 <br>
 <br>
 
+{{if $.FailingCalls}}
+<table>
+	<caption>Always failing syscalls (demoted by fuzzers):</caption>
+	<tr>
+		<th>Syscall</th>
+		<th>Errno</th>
+		<th>Execs</th>
+		<th>Fuzzers</th>
+	</tr>
+	{{range $c := $.FailingCalls}}
+	<tr>
+		<td>{{$c.Name}}</td>
+		<td>{{$c.Errno}}</td>
+		<td>{{$c.Execs}}</td>
+		<td>{{$c.Fuzzers}}</td>
+	</tr>
+	{{end}}
+</table>
+<br>
+{{end}}
+
 <b>Per-call coverage:</b>
 <br>
 {{range $c := $.Calls}}
@@ -614,13 +805,16 @@ var corpusTemplate = template.Must(template.New("").Parse(addStyle(`
 `)))
 
 type UIPrioData struct {
-	Call  string
-	Prios []UIPrio
+	Call    string
+	Prios   []UIPrio
+	Weights []string
 }
 
 type UIPrio struct {
-	Call string
-	Prio float32
+	Call     string
+	Prio     float32
+	Weight   float32
+	Weighted bool
 }
 
 type UIPrioArray []UIPrio
@@ -629,6 +823,43 @@ func (a UIPrioArray) Len() int           { return len(a) }
 func (a UIPrioArray) Less(i, j int) bool { return a[i].Prio > a[j].Prio }
 func (a UIPrioArray) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 
+var syscallsTemplate = template.Must(template.New("").Parse(addStyle(`
+<!doctype html>
+<html>
+<head>
+	<title>{{.Name }} syzkaller syscalls</title>
+	{{STYLE}}
+</head>
+<body>
+<b>{{.Name }} syzkaller syscalls</b> (<a href="/syscalls.json">json</a>)
+<br>
+<br>
+
+<table>
+	<tr>
+		<th>Syscall</th>
+		<th>Execs</th>
+		<th>Success</th>
+		<th>Top errnos</th>
+		<th>Signal</th>
+		<th>Flaky signal</th>
+		<th>Inputs (base syscall)</th>
+	</tr>
+	{{range $c := $.Syscalls}}
+	<tr>
+		<td>{{$c.Name}}</td>
+		<td>{{$c.Execs}}</td>
+		<td>{{$c.Success}} ({{printf "%.1f" $c.SuccessRate}}%)</td>
+		<td>{{range $e := $c.TopErrnos}}<span title="{{$e.Desc}}">{{$e.Errno}}:{{$e.Count}}</span> {{end}}</td>
+		<td>{{$c.Signal}}</td>
+		<td>{{$c.Flaky}}</td>
+		<td><a href='/corpus?call={{$c.CallName}}'>{{$c.Inputs}}</a></td>
+	</tr>
+	{{end}}
+</table>
+</body></html>
+`)))
+
 var prioTemplate = template.Must(template.New("").Parse(addStyle(`
 <!doctype html>
 <html>
@@ -638,8 +869,15 @@ var prioTemplate = template.Must(template.New("").Parse(addStyle(`
 </head>
 <body>
 Priorities for {{$.Call}} <br> <br>
+{{if $.Weights}}
+Syscall weights (included in priorities):
+{{range $w := $.Weights}}
+	{{$w}};
+{{end}}
+<br> <br>
+{{end}}
 {{range $p := $.Prios}}
-	{{printf "%.4f\t%s" $p.Prio $p.Call}} <br>
+	{{printf "%.4f\t%s" $p.Prio $p.Call}}{{if $p.Weighted}} (weight {{$p.Weight}}){{end}} <br>
 {{end}}
 </body></html>
 `)))
@@ -13,6 +13,7 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"syscall"
@@ -45,11 +46,15 @@ type Manager struct {
 	crashdir     string
 	port         int
 	corpusDB     *db.DB
+	infoDB       *db.DB     // signal and coverage of corpus inputs (see inputInfo)
+	infoMu       sync.Mutex // protects infoDB once fuzzing is started
+	kernelID     string     // build ID of vmlinux and hash of cover filter (see kernelID)
 	startTime    time.Time
 	firstConnect time.Time
 	lastPrioCalc time.Time
 	fuzzingTime  time.Duration
 	stats        map[string]uint64
+	callStats    map[string]*CallStats // per-syscall stats aggregated over all fuzzers
 	crashTypes   map[string]bool
 	vmStop       chan bool
 	vmChecked    bool
@@ -69,7 +74,12 @@ type Manager struct {
 	corpusSignal   map[uint32]struct{}
 	maxSignal      map[uint32]struct{}
 	corpusCover    map[uint32]struct{}
+	flakySignal    map[uint32]struct{} // signal excluded from new signal decisions
+	flakyReports   map[uint32]int      // signal reported as flaky, but not yet classified as such
 	prios          [][]float32
+	targets        map[uint32]int    // coverage PC -> distance to fuzzing targets (nil until resolved)
+	coverFilter    [][2]uint32       // PC ranges that restrict feedback signal
+	savedSignal    *signalCheckpoint // signal loaded from checkpoint, but not yet restored
 
 	fuzzers   map[string]*Fuzzer
 	hub       *RpcClient
@@ -90,9 +100,12 @@ const (
 )
 
 type Fuzzer struct {
-	name         string
-	inputs       []RpcInput
-	newMaxSignal []uint32
+	name           string
+	inputs         []RpcInput
+	newMaxSignal   []uint32
+	newFlakySignal []uint32
+	failingCalls   []FailingCall
+	targetsSent    bool
 }
 
 type Crash struct {
@@ -139,6 +152,7 @@ func RunManager(cfg *mgrconfig.Config, syscalls map[int]bool) {
 		crashdir:        crashdir,
 		startTime:       time.Now(),
 		stats:           make(map[string]uint64),
+		callStats:       make(map[string]*CallStats),
 		crashTypes:      make(map[string]bool),
 		enabledSyscalls: enabledSyscalls,
 		corpus:          make(map[string]RpcInput),
@@ -146,19 +160,42 @@ func RunManager(cfg *mgrconfig.Config, syscalls map[int]bool) {
 		corpusSignal:    make(map[uint32]struct{}),
 		maxSignal:       make(map[uint32]struct{}),
 		corpusCover:     make(map[uint32]struct{}),
+		flakySignal:     make(map[uint32]struct{}),
+		flakyReports:    make(map[uint32]int),
 		fuzzers:         make(map[string]*Fuzzer),
 		fresh:           true,
 		vmStop:          make(chan bool),
 	}
 
+	if len(cfg.Cover_Filter) != 0 {
+		// Fuzzers must filter signal from the very beginning, so we wait for the filter.
+		Logf(0, "resolving cover filter...")
+		if mgr.coverFilter, err = resolveCoverFilter(cfg.Vmlinux, cfg.Cover_Filter); err != nil {
+			Fatalf("failed to resolve cover filter: %v", err)
+		}
+	}
+	if mgr.kernelID, err = kernelID(cfg.Vmlinux, mgr.coverFilter); err != nil {
+		Logf(0, "failed to get kernel build ID: %v", err)
+	}
+
 	Logf(0, "loading corpus...")
 	mgr.corpusDB, err = db.Open(filepath.Join(cfg.Workdir, "corpus.db"))
 	if err != nil {
 		Fatalf("failed to open corpus database: %v", err)
 	}
-	deleted := 0
+	mgr.infoDB, err = db.Open(filepath.Join(cfg.Workdir, "corpus-info.db"))
+	if err != nil {
+		Fatalf("failed to open corpus info database: %v", err)
+	}
+	deleted, duplicate, numRepaired, restored := 0, 0, 0, 0
+	// Programs are keyed by semantic hash. Programs saved under a different key
+	// (e.g. repaired or saved by older versions) are re-saved under the right key.
+	// Programs with the same hash are not deleted, they are kept under the old key
+	// and triaged as usual.
+	keys := make(map[string]bool)
+	rekeyed := make(map[string][]byte)
 	for key, rec := range mgr.corpusDB.Records {
-		p, err := prog.Deserialize(rec.Val)
+		p, fixes, err := prog.DeserializeRepair(rec.Val)
 		if err != nil {
 			if deleted < 10 {
 				Logf(0, "deleting broken program: %v\n%s", err, rec.Val)
@@ -167,6 +204,24 @@ func RunManager(cfg *mgrconfig.Config, syscalls map[int]bool) {
 			deleted++
 			continue
 		}
+		if len(fixes) != 0 {
+			if numRepaired < 10 {
+				Logf(0, "repaired program:\n%s\nchanges:\n%v", rec.Val, strings.Join(fixes, "\n"))
+			}
+			numRepaired++
+			rec.Val = p.Serialize()
+		}
+		sig := p.SemanticHash()
+		newKey := sig.String()
+		if _, exists := mgr.corpusDB.Records[newKey]; keys[newKey] || exists && newKey != key {
+			duplicate++
+			newKey = key
+		}
+		keys[newKey] = true
+		if key != newKey || len(fixes) != 0 {
+			mgr.corpusDB.Delete(key)
+			rekeyed[newKey] = rec.Val
+		}
 		disabled := false
 		for _, c := range p.Calls {
 			if !syscalls[c.Meta.ID] {
@@ -180,16 +235,43 @@ func RunManager(cfg *mgrconfig.Config, syscalls map[int]bool) {
 			// it is not deleted during minimization.
 			// TODO: use mgr.enabledCalls which accounts for missing devices, etc.
 			// But it is available only after vm check.
-			mgr.disabledHashes[hash.String(rec.Val)] = struct{}{}
+			mgr.disabledHashes[newKey] = struct{}{}
 			continue
 		}
+		if cfg.Skip_Retriage && key == newKey && len(fixes) == 0 {
+			if inp, ok := mgr.restoreInput(key, p, rec.Val); ok {
+				mgr.corpus[key] = inp
+				cover.SignalAdd(mgr.corpusSignal, inp.Signal)
+				cover.SignalAdd(mgr.maxSignal, inp.Signal)
+				cover.SignalAdd(mgr.corpusCover, inp.Cover)
+				restored++
+				continue
+			}
+		}
 		mgr.candidates = append(mgr.candidates, RpcCandidate{
 			Prog:      rec.Val,
 			Minimized: true, // don't reminimize programs from corpus, it takes lots of time on start
 		})
 	}
+	for key, data := range rekeyed {
+		mgr.corpusDB.Save(key, data, 0)
+	}
+	if deleted != 0 || len(rekeyed) != 0 {
+		if err := mgr.corpusDB.Flush(); err != nil {
+			Fatalf("failed to save corpus database: %v", err)
+		}
+	}
+	for key := range mgr.infoDB.Records {
+		if _, ok := mgr.corpusDB.Records[key]; !ok {
+			mgr.infoDB.Delete(key)
+		}
+	}
+	if err := mgr.infoDB.Flush(); err != nil {
+		Fatalf("failed to save corpus info database: %v", err)
+	}
 	mgr.fresh = len(mgr.corpusDB.Records) == 0
-	Logf(0, "loaded %v programs (%v total, %v deleted)", len(mgr.candidates), len(mgr.corpusDB.Records), deleted)
+	Logf(0, "loaded %v programs (%v total, %v deleted, %v with duplicate hash, %v repaired, %v restored without triage)",
+		len(mgr.candidates), len(mgr.corpusDB.Records), deleted, duplicate, numRepaired, restored)
 
 	// Now this is ugly.
 	// We duplicate all inputs in the corpus and shuffle the second part.
@@ -203,12 +285,19 @@ func RunManager(cfg *mgrconfig.Config, syscalls map[int]bool) {
 		j := i + rand.Intn(len(shuffle)-i)
 		shuffle[i], shuffle[j] = shuffle[j], shuffle[i]
 	}
+	mgr.loadSignal()
+	go mgr.checkpointSignalLoop()
+	go mgr.flushInputInfoLoop()
+
+	if len(cfg.Targets) != 0 {
+		go mgr.resolveTargets()
+	}
 
 	// Create HTTP server.
 	mgr.initHttp()
 
 	// Create RPC server for fuzzers.
-	s, err := NewRpcServer(cfg.Rpc, mgr)
+	s, err := NewRpcServer(cfg.Rpc, mgr, cfg.Rpc_Compression)
 	if err != nil {
 		Fatalf("failed to create rpc server: %v", err)
 	}
@@ -290,6 +379,8 @@ func RunManager(cfg *mgrconfig.Config, syscalls map[int]bool) {
 		<-c
 		close(vm.Shutdown)
 		Logf(0, "shutting down...")
+		mgr.flushInputInfo()
+		mgr.checkpointSignal()
 		<-c
 		Fatalf("terminating")
 	}()
@@ -473,8 +564,9 @@ func (mgr *Manager) runInstance(index int) (*Crash, error) {
 	start := time.Now()
 	atomic.AddUint32(&mgr.numFuzzing, 1)
 	defer atomic.AddUint32(&mgr.numFuzzing, ^uint32(0))
-	cmd := fmt.Sprintf("%v -executor=%v -name=vm-%v -manager=%v -procs=%v -leak=%v -cover=%v -sandbox=%v -debug=%v -v=%d",
-		fuzzerBin, executorBin, index, fwdAddr, procs, leak, mgr.cfg.Cover, mgr.cfg.Sandbox, *flagDebug, fuzzerV)
+	cmd := fmt.Sprintf("%v -executor=%v -name=vm-%v -manager=%v -procs=%v -leak=%v -cover=%v -sandbox=%v -seed_schedule=%v -work_schedule=%v -work_ratios=%q -rpc_compression=%v -debug=%v -v=%d",
+		fuzzerBin, executorBin, index, fwdAddr, procs, leak, mgr.cfg.Cover, mgr.cfg.Sandbox,
+		mgr.cfg.Seed_Schedule, mgr.cfg.Work_Schedule, mgr.cfg.ParsedWorkRatios, mgr.cfg.Rpc_Compression, *flagDebug, fuzzerV)
 	outc, errc, err := inst.Run(time.Hour, mgr.vmStop, cmd)
 	if err != nil {
 		return nil, fmt.Errorf("failed to run fuzzer: %v", err)
@@ -687,15 +779,15 @@ func (mgr *Manager) saveRepro(res *repro.Result) {
 func (mgr *Manager) minimizeCorpus() {
 	if mgr.cfg.Cover && len(mgr.corpus) != 0 {
 		var cov []cover.Cover
-		var inputs []RpcInput
-		for _, inp := range mgr.corpus {
-			cov = append(cov, inp.Signal)
-			inputs = append(inputs, inp)
+		var keys []string
+		for key, inp := range mgr.corpus {
+			cov = append(cov, cover.Cover(inp.Signal))
+			keys = append(keys, key)
 		}
 		newCorpus := make(map[string]RpcInput)
 		for _, idx := range cover.Minimize(cov) {
-			inp := inputs[idx]
-			newCorpus[hash.String(inp.Prog)] = inp
+			key := keys[idx]
+			newCorpus[key] = mgr.corpus[key]
 		}
 		Logf(1, "minimized corpus: %v -> %v", len(mgr.corpus), len(newCorpus))
 		mgr.corpus = newCorpus
@@ -708,6 +800,9 @@ func (mgr *Manager) minimizeCorpus() {
 			_, ok2 := mgr.disabledHashes[key]
 			if !ok1 && !ok2 {
 				mgr.corpusDB.Delete(key)
+				mgr.infoMu.Lock()
+				mgr.infoDB.Delete(key)
+				mgr.infoMu.Unlock()
 			}
 		}
 		mgr.corpusDB.Flush()
@@ -715,7 +810,14 @@ func (mgr *Manager) minimizeCorpus() {
 }
 
 func (mgr *Manager) Connect(a *ConnectArgs, r *ConnectRes) error {
-	Logf(1, "fuzzer %v connected", a.Name)
+	if a.Version != ProtocolVersion {
+		err := fmt.Errorf("fuzzer %v uses protocol version %v, but manager uses version %v"+
+			" (syz-fuzzer and syz-manager binaries are from different syzkaller revisions?)",
+			a.Name, a.Version, ProtocolVersion)
+		Logf(0, "%v", err)
+		return err
+	}
+	Logf(1, "fuzzer %v connected (reconnect=%v)", a.Name, a.Reconnect)
 	mgr.mu.Lock()
 	defer mgr.mu.Unlock()
 
@@ -724,7 +826,11 @@ func (mgr *Manager) Connect(a *ConnectArgs, r *ConnectRes) error {
 		Logf(0, "received first connection from test machine %v", a.Name)
 	}
 
-	mgr.stats["vm restarts"]++
+	if a.Reconnect {
+		mgr.stats["fuzzer reconnects"]++
+	} else {
+		mgr.stats["vm restarts"]++
+	}
 	f := &Fuzzer{
 		name: a.Name,
 	}
@@ -749,6 +855,7 @@ func (mgr *Manager) Connect(a *ConnectArgs, r *ConnectRes) error {
 			corpus = append(corpus, p)
 		}
 		prios := prog.CalculatePriorities(corpus)
+		prog.ApplyCallWeights(prios, mgr.cfg.ParsedWeights)
 
 		mgr.mu.Lock()
 		mgr.prios = prios
@@ -756,16 +863,30 @@ func (mgr *Manager) Connect(a *ConnectArgs, r *ConnectRes) error {
 
 	f.inputs = nil
 	for _, inp := range mgr.corpus {
+		if mgr.targets != nil {
+			// Fuzzers need coverage only to find inputs that reach fuzzing targets.
+			inp.Cover = mgr.targetCover(inp.Cover)
+		}
 		r.Inputs = append(r.Inputs, inp)
 	}
+	r.Version = ProtocolVersion
+	r.Targets = mgr.targets
+	f.targetsSent = mgr.targets != nil
+	r.CoverFilter = mgr.coverFilter
 	r.Prios = mgr.prios
 	r.EnabledCalls = mgr.enabledSyscalls
 	r.NeedCheck = !mgr.vmChecked
+	r.Dict = mgr.cfg.DictData
 	r.MaxSignal = make([]uint32, 0, len(mgr.maxSignal))
 	for s := range mgr.maxSignal {
 		r.MaxSignal = append(r.MaxSignal, s)
 	}
 	f.newMaxSignal = nil
+	r.FlakySignal = make([]uint32, 0, len(mgr.flakySignal))
+	for s := range mgr.flakySignal {
+		r.FlakySignal = append(r.FlakySignal, s)
+	}
+	f.newFlakySignal = nil
 	for i := 0; i < mgr.cfg.Procs && len(mgr.candidates) > 0; i++ {
 		last := len(mgr.candidates) - 1
 		r.Candidates = append(r.Candidates, mgr.candidates[last])
@@ -807,33 +928,45 @@ func (mgr *Manager) NewInput(a *NewInputArgs, r *int) error {
 
 	f := mgr.fuzzers[a.Name]
 	if f == nil {
-		Fatalf("fuzzer %v is not connected", a.Name)
+		// This happens if manager was restarted, the fuzzer will reconnect.
+		return fmt.Errorf("%v: %v", NotConnectedError, a.Name)
 	}
 
-	if !cover.SignalNew(mgr.corpusSignal, a.Signal) {
+	if !mgr.newCorpusSignal(a.Signal) {
 		return nil
 	}
+	hashSig, err := prog.SemanticHashData(a.RpcInput.Prog)
+	if err != nil {
+		return fmt.Errorf("failed to deserialize input from fuzzer %v: %v", a.Name, err)
+	}
+	sig := hashSig.String()
 	mgr.stats["manager new inputs"]++
 	cover.SignalAdd(mgr.corpusSignal, a.Signal)
 	cover.SignalAdd(mgr.corpusCover, a.Cover)
-	sig := hash.String(a.RpcInput.Prog)
 	if inp, ok := mgr.corpus[sig]; ok {
-		// The input is already present, but possibly with diffent signal/coverage/call.
-		inp.Signal = cover.Union(inp.Signal, a.RpcInput.Signal)
-		inp.Cover = cover.Union(inp.Cover, a.RpcInput.Cover)
-		mgr.corpus[sig] = inp
+		// The input (or a semantically equal one) is already present,
+		// but possibly with diffent signal/coverage/call.
+		signal := cover.Union(cover.Cover(inp.Signal), cover.Cover(a.RpcInput.Signal))
+		cov := cover.Union(cover.Cover(inp.Cover), cover.Cover(a.RpcInput.Cover))
+		if len(signal) != len(inp.Signal) || len(cov) != len(inp.Cover) {
+			inp.Signal = Signal(signal)
+			inp.Cover = Signal(cov)
+			mgr.corpus[sig] = inp
+			mgr.saveInputInfo(sig, inp)
+		}
 	} else {
 		mgr.corpus[sig] = a.RpcInput
 		mgr.corpusDB.Save(sig, a.RpcInput.Prog, 0)
 		if err := mgr.corpusDB.Flush(); err != nil {
 			Logf(0, "failed to save corpus database: %v", err)
 		}
+		mgr.saveInputInfo(sig, a.RpcInput)
 		for _, f1 := range mgr.fuzzers {
 			if f1 == f {
 				continue
 			}
 			inp := a.RpcInput
-			inp.Cover = nil // Don't send coverage back to all fuzzers.
+			inp.Cover = mgr.targetCover(inp.Cover) // Don't send whole coverage back to all fuzzers.
 			f1.inputs = append(f1.inputs, inp)
 		}
 	}
@@ -844,13 +977,28 @@ func (mgr *Manager) Poll(a *PollArgs, r *PollRes) error {
 	mgr.mu.Lock()
 	defer mgr.mu.Unlock()
 
+	f := mgr.fuzzers[a.Name]
+	if f == nil {
+		// This happens if manager was restarted, the fuzzer will reconnect.
+		return fmt.Errorf("%v: %v", NotConnectedError, a.Name)
+	}
 	for k, v := range a.Stats {
 		mgr.stats[k] += v
 	}
-
-	f := mgr.fuzzers[a.Name]
-	if f == nil {
-		Fatalf("fuzzer %v is not connected", a.Name)
+	f.failingCalls = a.FailingCalls
+	for name, stat := range a.CallStats {
+		total := mgr.callStats[name]
+		if total == nil {
+			total = &CallStats{Errnos: make(map[int]uint64)}
+			mgr.callStats[name] = total
+		}
+		total.Execs += stat.Execs
+		total.Success += stat.Success
+		total.Signal += stat.Signal
+		total.Flaky += stat.Flaky
+		for errno, n := range stat.Errnos {
+			total.Errnos[errno] += n
+		}
 	}
 	var newMaxSignal []uint32
 	for _, s := range a.MaxSignal {
@@ -866,8 +1014,23 @@ func (mgr *Manager) Poll(a *PollArgs, r *PollRes) error {
 		}
 		f1.newMaxSignal = append(f1.newMaxSignal, newMaxSignal...)
 	}
+	mgr.addFlakyReports(a.FlakySignal)
 	r.MaxSignal = f.newMaxSignal
 	f.newMaxSignal = nil
+	r.FlakySignal = f.newFlakySignal
+	f.newFlakySignal = nil
+	if !f.targetsSent && mgr.targets != nil {
+		r.Targets = mgr.targets
+		f.targetsSent = true
+		// Inputs sent to the fuzzer before targets were resolved did not carry target cover.
+		// Send the ones that reach targets again, so that the fuzzer uses them as directed seeds.
+		for _, inp := range mgr.corpus {
+			if cov := mgr.targetCover(inp.Cover); len(cov) != 0 {
+				inp.Cover = cov
+				f.inputs = append(f.inputs, inp)
+			}
+		}
+	}
 	for i := 0; i < 100 && len(f.inputs) > 0; i++ {
 		last := len(f.inputs) - 1
 		r.NewInputs = append(r.NewInputs, f.inputs[last])
@@ -925,20 +1088,24 @@ func (mgr *Manager) hubSync() {
 			Calls:   mgr.enabledCalls,
 		}
 		hubCorpus := make(map[hash.Sig]bool)
-		for _, inp := range mgr.corpus {
-			hubCorpus[hash.Hash(inp.Prog)] = true
+		for key, inp := range mgr.corpus {
+			sig, err := hash.FromString(key)
+			if err != nil {
+				Fatalf("bad corpus key %v: %v", key, err)
+			}
+			hubCorpus[sig] = true
 			a.Corpus = append(a.Corpus, inp.Prog)
 		}
 		mgr.mu.Unlock()
 		// Hub.Connect request can be very large, so do it on a transient connection
 		// (rpc connection buffers never shrink).
 		// Also don't do hub rpc's under the mutex -- hub can be slow or inaccessible.
-		if err := RpcCall(mgr.cfg.Hub_Addr, "Hub.Connect", a, nil); err != nil {
+		if err := RpcCall(mgr.cfg.Hub_Addr, false, "Hub.Connect", a, nil); err != nil {
 			mgr.mu.Lock()
 			Logf(0, "Hub.Connect rpc failed: %v", err)
 			return
 		}
-		conn, err := NewRpcClient(mgr.cfg.Hub_Addr)
+		conn, err := NewRpcClient(mgr.cfg.Hub_Addr, false)
 		if err != nil {
 			mgr.mu.Lock()
 			Logf(0, "failed to connect to hub at %v: %v", mgr.cfg.Hub_Addr, err)
@@ -957,8 +1124,11 @@ func (mgr *Manager) hubSync() {
 		Manager: mgr.cfg.Name,
 	}
 	corpus := make(map[hash.Sig]bool)
-	for _, inp := range mgr.corpus {
-		sig := hash.Hash(inp.Prog)
+	for key, inp := range mgr.corpus {
+		sig, err := hash.FromString(key)
+		if err != nil {
+			Fatalf("bad corpus key %v: %v", key, err)
+		}
 		corpus[sig] = true
 		if mgr.hubCorpus[sig] {
 			continue
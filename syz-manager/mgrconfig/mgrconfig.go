@@ -6,12 +6,15 @@ package mgrconfig
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/google/syzkaller/pkg/config"
 	"github.com/google/syzkaller/pkg/osutil"
+	"github.com/google/syzkaller/prog"
 	"github.com/google/syzkaller/sys"
 	"github.com/google/syzkaller/vm"
 )
@@ -47,11 +50,44 @@ type Config struct {
 	Cover     bool // use kcov coverage (default: true)
 	Leak      bool // do memory leak checking
 	Reproduce bool // reproduce, localize and minimize crashers (on by default)
+	// Don't re-triage corpus inputs on restart if the kernel (vmlinux build ID) is unchanged,
+	// restore their signal and coverage saved in workdir/corpus-info.db instead.
+	Skip_Retriage bool
+	// Compress RPC traffic between manager and fuzzers, useful with lots of VMs or a slow network.
+	Rpc_Compression bool
+
+	Seed_Schedule string // policy of choosing corpus programs for mutation:
+	// "uniform": all programs are chosen with equal probability, default
+	// "rare": prefer programs that cover rare signal
+	// "power": prefer programs whose mutants recently gave new signal
+
+	Work_Schedule string // policy of scheduling work inside of fuzzer processes:
+	// "priority": candidates, triage, smash, generate and mutate in this order, default
+	// "weighted": choose kind of work randomly (candidates are still processed first)
+	// Ratios of kinds of work: triage, smash, generate, fuzz (mutation), e.g. {"smash": 0.5, "generate": 0.1}.
+	// For priority schedule it's the probability to do pending work of that kind (generate is the
+	// probability to generate instead of mutate, default 0.01; others are 1 by default),
+	// for weighted schedule it's relative weight of the kind of work.
+	Work_Ratios map[string]float64
+
+	// Kernel functions or source files to direct fuzzing to, e.g. ["tcp_sendmsg", "net/ipv4/tcp.c"].
+	// Fuzzers prioritize inputs and syscalls that cover targets or functions that call them.
+	Targets []string
+
+	// Restricts feedback signal to the given kernel functions, source files or PC ranges,
+	// e.g. ["tcp_sendmsg", "net/ipv4/tcp.c", "0xffffffff81000000-0xffffffff81100000"].
+	// Coverage is still collected and reported for the whole kernel.
+	Cover_Filter []string
 
 	Enable_Syscalls  []string
 	Disable_Syscalls []string
 	Suppressions     []string // don't save reports matching these regexps, but reboot VM after them
 	Ignores          []string // completely ignore reports matching these regexps (don't save nor reboot)
+	Dict             string   // JSON file with user-supplied values used in generation/mutation (see prog.ParseDict)
+
+	// Weights that scale priorities of syscalls, e.g. {"ioctl$KVM*": 10, "open": 0.5}.
+	// Keys are syscall names or globs like in enable_syscalls, more specific keys take precedence.
+	Syscall_Weights map[string]float64
 
 	Type string          // VM type (qemu, kvm, local)
 	VM   json.RawMessage // VM-type-specific config
@@ -59,6 +95,9 @@ type Config struct {
 	// Implementation details beyond this point.
 	ParsedSuppressions []*regexp.Regexp `json:"-"`
 	ParsedIgnores      []*regexp.Regexp `json:"-"`
+	ParsedWeights      map[int]float32  `json:"-"` // syscall ID -> weight
+	DictData           []byte           `json:"-"`
+	ParsedWorkRatios   string           `json:"-"` // work ratios in syz-fuzzer flag format
 }
 
 func LoadData(data []byte) (*Config, map[int]bool, error) {
@@ -76,6 +115,9 @@ func load(data []byte, filename string) (*Config, map[int]bool, error) {
 		Sandbox:   "setuid",
 		Rpc:       "localhost:0",
 		Procs:     1,
+
+		Seed_Schedule: "uniform",
+		Work_Schedule: "priority",
 	}
 	if data != nil {
 		if err := config.LoadData(data, cfg); err != nil {
@@ -115,6 +157,11 @@ func load(data []byte, filename string) (*Config, map[int]bool, error) {
 	default:
 		return nil, nil, fmt.Errorf("config param sandbox must contain one of none/setuid/namespace")
 	}
+	switch cfg.Seed_Schedule {
+	case "uniform", "rare", "power":
+	default:
+		return nil, nil, fmt.Errorf("config param seed_schedule must contain one of uniform/rare/power")
+	}
 
 	cfg.Workdir = osutil.Abs(cfg.Workdir)
 	cfg.Vmlinux = osutil.Abs(cfg.Vmlinux)
@@ -132,6 +179,25 @@ func load(data []byte, filename string) (*Config, map[int]bool, error) {
 		return nil, nil, err
 	}
 
+	if err := parseDict(cfg); err != nil {
+		return nil, nil, err
+	}
+
+	if err := parseSyscallWeights(cfg); err != nil {
+		return nil, nil, err
+	}
+
+	if err := parseWorkRatios(cfg); err != nil {
+		return nil, nil, err
+	}
+
+	if len(cfg.Targets) != 0 && !cfg.Cover {
+		return nil, nil, fmt.Errorf("config param targets requires cover")
+	}
+	if len(cfg.Cover_Filter) != 0 && !cfg.Cover {
+		return nil, nil, fmt.Errorf("config param cover_filter requires cover")
+	}
+
 	if cfg.Hub_Client != "" && (cfg.Name == "" || cfg.Hub_Addr == "" || cfg.Hub_Key == "") {
 		return nil, nil, fmt.Errorf("hub_client is set, but name/hub_addr/hub_key is empty")
 	}
@@ -144,23 +210,23 @@ func load(data []byte, filename string) (*Config, map[int]bool, error) {
 	return cfg, syscalls, nil
 }
 
-func parseSyscalls(cfg *Config) (map[int]bool, error) {
-	match := func(call *sys.Call, str string) bool {
-		if str == call.CallName || str == call.Name {
-			return true
-		}
-		if len(str) > 1 && str[len(str)-1] == '*' && strings.HasPrefix(call.Name, str[:len(str)-1]) {
-			return true
-		}
-		return false
+func matchSyscall(call *sys.Call, str string) bool {
+	if str == call.CallName || str == call.Name {
+		return true
 	}
+	if len(str) > 1 && str[len(str)-1] == '*' && strings.HasPrefix(call.Name, str[:len(str)-1]) {
+		return true
+	}
+	return false
+}
 
+func parseSyscalls(cfg *Config) (map[int]bool, error) {
 	syscalls := make(map[int]bool)
 	if len(cfg.Enable_Syscalls) != 0 {
 		for _, c := range cfg.Enable_Syscalls {
 			n := 0
 			for _, call := range sys.Calls {
-				if match(call, c) {
+				if matchSyscall(call, c) {
 					syscalls[call.ID] = true
 					n++
 				}
@@ -177,7 +243,7 @@ func parseSyscalls(cfg *Config) (map[int]bool, error) {
 	for _, c := range cfg.Disable_Syscalls {
 		n := 0
 		for _, call := range sys.Calls {
-			if match(call, c) {
+			if matchSyscall(call, c) {
 				delete(syscalls, call.ID)
 				n++
 			}
@@ -232,3 +298,88 @@ func CreateVMEnv(cfg *Config, debug bool) *vm.Env {
 		Config:  cfg.VM,
 	}
 }
+
+func parseSyscallWeights(cfg *Config) error {
+	// specificity orders patterns that match the same syscall:
+	// full name, then base syscall name, then longer globs.
+	specificity := func(call *sys.Call, pattern string) int {
+		switch pattern {
+		case call.Name:
+			return 1 << 20
+		case call.CallName:
+			return 1 << 19
+		default:
+			return len(pattern)
+		}
+	}
+	matched := make(map[string]bool)
+	cfg.ParsedWeights = make(map[int]float32)
+	for _, call := range sys.Calls {
+		best := ""
+		for pattern := range cfg.Syscall_Weights {
+			if !matchSyscall(call, pattern) {
+				continue
+			}
+			matched[pattern] = true
+			if best == "" || specificity(call, pattern) > specificity(call, best) {
+				best = pattern
+			}
+		}
+		if best != "" {
+			cfg.ParsedWeights[call.ID] = float32(cfg.Syscall_Weights[best])
+		}
+	}
+	for pattern, w := range cfg.Syscall_Weights {
+		if !matched[pattern] {
+			return fmt.Errorf("unknown syscall in syscall_weights: %v", pattern)
+		}
+		if w <= 0 {
+			return fmt.Errorf("bad weight for syscall %v: %v, want > 0 (use disable_syscalls to disable syscalls)",
+				pattern, w)
+		}
+	}
+	return nil
+}
+
+func parseDict(cfg *Config) error {
+	if cfg.Dict == "" {
+		return nil
+	}
+	cfg.Dict = osutil.Abs(cfg.Dict)
+	data, err := ioutil.ReadFile(cfg.Dict)
+	if err != nil {
+		return fmt.Errorf("failed to read dict: %v", err)
+	}
+	if _, err := prog.ParseDict(data); err != nil {
+		return fmt.Errorf("bad dict %v: %v", cfg.Dict, err)
+	}
+	cfg.DictData = data
+	return nil
+}
+
+func parseWorkRatios(cfg *Config) error {
+	switch cfg.Work_Schedule {
+	case "priority", "weighted":
+	default:
+		return fmt.Errorf("config param work_schedule must contain one of priority/weighted")
+	}
+	var kinds []string
+	for kind, v := range cfg.Work_Ratios {
+		switch kind {
+		case "triage", "smash", "generate", "fuzz":
+		default:
+			return fmt.Errorf("unknown kind of work in work_ratios: %v, want one of triage/smash/generate/fuzz", kind)
+		}
+		if v < 0 || v > 1 && cfg.Work_Schedule == "priority" {
+			return fmt.Errorf("bad work ratio for %v: %v", kind, v)
+		}
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	var ratios []string
+	for _, kind := range kinds {
+		ratios = append(ratios, fmt.Sprintf("%v=%v", kind, cfg.Work_Ratios[kind]))
+	}
+	cfg.ParsedWorkRatios = strings.Join(ratios, ",")
+	return nil
+}
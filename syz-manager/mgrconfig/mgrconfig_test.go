@@ -4,9 +4,11 @@
 package mgrconfig
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/google/syzkaller/pkg/config"
+	"github.com/google/syzkaller/sys"
 	"github.com/google/syzkaller/vm/qemu"
 )
 
@@ -26,3 +28,65 @@ func TestCanned(t *testing.T) {
 		t.Fatalf("failed to load %v config: %v", cfg.Type, err)
 	}
 }
+
+func TestSyscallWeights(t *testing.T) {
+	cfg := &Config{
+		Syscall_Weights: map[string]float64{
+			"open":          2,
+			"open$dir":      3,
+			"ioctl$KVM*":    4,
+			"ioctl$KVM_RUN": 5,
+		},
+	}
+	if err := parseSyscallWeights(cfg); err != nil {
+		t.Fatal(err)
+	}
+	for _, call := range sys.Calls {
+		want, ok := float32(0), false
+		switch {
+		case call.Name == "open$dir":
+			want, ok = 3, true
+		case call.CallName == "open":
+			want, ok = 2, true
+		case call.Name == "ioctl$KVM_RUN":
+			want, ok = 5, true
+		case strings.HasPrefix(call.Name, "ioctl$KVM"):
+			want, ok = 4, true
+		}
+		if w, ok1 := cfg.ParsedWeights[call.ID]; ok1 != ok || w != want {
+			t.Errorf("%v: got weight %v/%v, want %v/%v", call.Name, w, ok1, want, ok)
+		}
+	}
+	for _, weights := range []map[string]float64{
+		{"foobar": 1},
+		{"open": -1},
+		{"open": 0},
+	} {
+		if err := parseSyscallWeights(&Config{Syscall_Weights: weights}); err == nil {
+			t.Errorf("parsing of %v did not fail", weights)
+		}
+	}
+}
+
+func TestWorkRatios(t *testing.T) {
+	cfg := &Config{
+		Work_Schedule: "priority",
+		Work_Ratios:   map[string]float64{"smash": 0.5, "generate": 0.1},
+	}
+	if err := parseWorkRatios(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if want := "generate=0.1,smash=0.5"; cfg.ParsedWorkRatios != want {
+		t.Fatalf("got ratios %q, want %q", cfg.ParsedWorkRatios, want)
+	}
+	for _, cfg := range []*Config{
+		{Work_Schedule: "foo"},
+		{Work_Schedule: "priority", Work_Ratios: map[string]float64{"foo": 1}},
+		{Work_Schedule: "priority", Work_Ratios: map[string]float64{"smash": 2}},
+		{Work_Schedule: "weighted", Work_Ratios: map[string]float64{"fuzz": -1}},
+	} {
+		if err := parseWorkRatios(cfg); err == nil {
+			t.Errorf("parsing of %v/%v did not fail", cfg.Work_Schedule, cfg.Work_Ratios)
+		}
+	}
+}
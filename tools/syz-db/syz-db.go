@@ -8,23 +8,37 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/google/syzkaller/pkg/db"
-	"github.com/google/syzkaller/pkg/hash"
 	"github.com/google/syzkaller/pkg/osutil"
+	"github.com/google/syzkaller/prog"
 )
 
 func main() {
-	if len(os.Args) != 4 {
+	if len(os.Args) < 3 {
 		usage()
 	}
 	switch os.Args[1] {
 	case "pack":
+		if len(os.Args) != 4 {
+			usage()
+		}
 		pack(os.Args[2], os.Args[3])
 	case "unpack":
+		if len(os.Args) != 4 {
+			usage()
+		}
 		unpack(os.Args[2], os.Args[3])
+	case "validate":
+		if len(os.Args) != 3 {
+			usage()
+		}
+		validateDB(os.Args[2])
+	case "validate-log":
+		validateLogs(os.Args[2:])
 	default:
 		usage()
 	}
@@ -34,6 +48,8 @@ func usage() {
 	fmt.Fprintf(os.Stderr, "usage:\n")
 	fmt.Fprintf(os.Stderr, "  syz-db pack dir corpus.db\n")
 	fmt.Fprintf(os.Stderr, "  syz-db unpack corpus.db dir\n")
+	fmt.Fprintf(os.Stderr, "  syz-db validate corpus.db\n")
+	fmt.Fprintf(os.Stderr, "  syz-db validate-log log-file+\n")
 	os.Exit(1)
 }
 
@@ -61,9 +77,14 @@ func pack(dir, file string) {
 				key = parts[0]
 			}
 		}
-		if sig := hash.String(data); key != sig {
-			fmt.Fprintf(os.Stderr, "fixing hash %v -> %v\n", key, sig)
-			key = sig
+		sig, err := prog.SemanticHashData(data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "skipping %v: failed to deserialize: %v\n", file.Name(), err)
+			continue
+		}
+		if key != sig.String() {
+			fmt.Fprintf(os.Stderr, "fixing hash %v -> %v\n", key, sig.String())
+			key = sig.String()
 		}
 		db.Save(key, data, seq)
 	}
@@ -89,6 +110,68 @@ func unpack(file, dir string) {
 	}
 }
 
+func validateDB(file string) {
+	if !osutil.IsExist(file) {
+		failf("database %v does not exist", file)
+	}
+	db, err := db.Open(file)
+	if err != nil {
+		failf("failed to open database: %v", err)
+	}
+	var keys []string
+	for key := range db.Records {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	bad := 0
+	for _, key := range keys {
+		if !validate(key, db.Records[key].Val) {
+			bad++
+		}
+	}
+	fmt.Printf("%v programs, %v invalid\n", len(keys), bad)
+	if bad != 0 {
+		os.Exit(1)
+	}
+}
+
+func validateLogs(files []string) {
+	total, bad := 0, 0
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			failf("failed to read log file: %v", err)
+		}
+		for _, ent := range prog.ParseLog(data) {
+			total++
+			if !validateProg(fmt.Sprintf("%v:%v", file, ent.Start), ent.P) {
+				bad++
+			}
+		}
+	}
+	fmt.Printf("%v programs, %v invalid\n", total, bad)
+	if bad != 0 {
+		os.Exit(1)
+	}
+}
+
+func validate(name string, data []byte) bool {
+	p, err := prog.Deserialize(data)
+	if err != nil {
+		fmt.Printf("%v: failed to deserialize: %v\n", name, err)
+		return false
+	}
+	return validateProg(name, p)
+}
+
+func validateProg(name string, p *prog.Prog) bool {
+	errs := p.Validate()
+	for _, err := range errs {
+		fmt.Printf("%v: %v\n", name, err)
+	}
+	return len(errs) == 0
+}
+
 func failf(msg string, args ...interface{}) {
 	fmt.Fprintf(os.Stderr, msg+"\n", args...)
 	os.Exit(1)
@@ -30,7 +30,7 @@ var (
 	flagCoverFile = flag.String("coverfile", "", "write coverage to the file")
 	flagRepeat    = flag.Int("repeat", 1, "repeat execution that many times (0 for infinite loop)")
 	flagProcs     = flag.Int("procs", 1, "number of parallel processes to execute programs")
-	flagOutput    = flag.String("output", "none", "write programs to none/stdout")
+	flagOutput    = flag.String("output", "none", "write programs to none/stdout/annotated")
 	flagFaultCall = flag.Int("fault_call", -1, "inject fault into this call (0-based)")
 	flagFaultNth  = flag.Int("fault_nth", 0, "inject fault on n-th operation (0-based)")
 )
@@ -136,6 +136,12 @@ func main() {
 					if atomic.LoadUint32(&shutdown) != 0 {
 						return false
 					}
+					if *flagOutput == "annotated" && info != nil {
+						data := p.Annotate(ipc.CallResults(info))
+						logMu.Lock()
+						Logf(0, "executed program %v:\n%s", pid, data)
+						logMu.Unlock()
+					}
 					if failed {
 						fmt.Printf("BUG: executor-detected bug:\n%s", output)
 					}
@@ -17,6 +17,7 @@ import (
 
 var (
 	flagSeed = flag.Int("seed", -1, "prng seed")
+	flagDiff = flag.Bool("diff", false, "print differences between the original and the mutated program")
 )
 
 func main() {
@@ -44,6 +45,12 @@ func main() {
 		seed = int64(*flagSeed)
 	}
 	rs := rand.NewSource(seed)
+	p0 := p.Clone()
 	p.Mutate(rs, len(p.Calls)+10, ct, nil)
 	fmt.Printf("%s\n", p.Serialize())
+	if *flagDiff {
+		for _, d := range prog.Diff(p0, p) {
+			fmt.Printf("%v\n", d)
+		}
+	}
 }
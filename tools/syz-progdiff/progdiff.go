@@ -0,0 +1,51 @@
+// Copyright 2017 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+// progdiff prints structural differences between two programs:
+// added/removed calls and changed arguments of matching calls.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/google/syzkaller/prog"
+)
+
+var (
+	flagCount = flag.Bool("count", false, "print only the number of differences")
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 2 {
+		fmt.Fprintf(os.Stderr, "usage: syz-progdiff [-count] program1 program2\n")
+		os.Exit(1)
+	}
+	p1 := readProg(flag.Arg(0))
+	p2 := readProg(flag.Arg(1))
+	diff := prog.Diff(p1, p2)
+	if *flagCount {
+		fmt.Printf("%v\n", len(diff))
+		return
+	}
+	for _, d := range diff {
+		fmt.Printf("%v\n", d)
+	}
+}
+
+func readProg(fname string) *prog.Prog {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read prog file: %v\n", err)
+		os.Exit(1)
+	}
+	p, err := prog.Deserialize(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to deserialize the program %v: %v\n", fname, err)
+		os.Exit(1)
+	}
+	return p
+}
@@ -5,6 +5,8 @@
 // Upgrade is not fully automatic. You need to update prog.Serialize.
 // Run the tool. Then update prog.Deserialize. And run the tool again that
 // the corpus is not changed this time.
+// Programs that don't match current descriptions (e.g. refer to removed
+// syscalls or struct fields) are repaired with prog.DeserializeRepair.
 package main
 
 import (
@@ -34,15 +36,19 @@ func main() {
 		if err != nil {
 			fatalf("failed to read program: %v", err)
 		}
-		p, err := prog.Deserialize(data)
+		p, fixes, err := prog.DeserializeRepair(data)
 		if err != nil {
-			fatalf("failed to deserialize program: %v", err)
+			fatalf("failed to deserialize program %v: %v", fname, err)
 		}
 		data1 := p.Serialize()
 		if bytes.Equal(data, data1) {
 			continue
 		}
-		fmt.Printf("upgrading:\n%s\nto:\n%s\n\n", data, data1)
+		fmt.Printf("upgrading:\n%s\nto:\n%s\n", data, data1)
+		for _, fix := range fixes {
+			fmt.Printf("  %v\n", fix)
+		}
+		fmt.Printf("\n")
 		hash := sha1.Sum(data1)
 		fname1 := filepath.Join(os.Args[1], hex.EncodeToString(hash[:]))
 		if err := osutil.WriteFile(fname1, data1); err != nil {